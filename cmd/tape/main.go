@@ -2,9 +2,16 @@ package main
 
 import (
 	"fmt"
+	"io/ioutil"
+	"net"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
 
 	"github.com/osdi23p228/tape/pkg/infra"
+	"github.com/osdi23p228/tape/pkg/mock"
 
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
@@ -20,6 +27,30 @@ var (
 	run        = app.Command("run", "Run this program").Default()
 	version    = app.Command("version", "Show version information")
 	configFile = run.Flag("config", "Path of config file").Required().Short('c').String()
+	sets       = run.Flag("set", "Override a config field, e.g. --set rate=500 --set endorsers[0].address=localhost:7051").Strings()
+	dryRun     = run.Flag("dry-run", "Generate, sign and assemble transactions without a network").Bool()
+
+	validate           = app.Command("validate", "Validate config file and exit")
+	validateConfigFile = validate.Flag("config", "Path of config file").Required().Short('c').String()
+	validateSets       = validate.Flag("set", "Override a config field, e.g. --set rate=500").Strings()
+
+	check           = app.Command("check", "Check connectivity and permissions of all nodes and exit")
+	checkConfigFile = check.Flag("config", "Path of config file").Required().Short('c').String()
+	checkSets       = check.Flag("set", "Override a config field, e.g. --set rate=500").Strings()
+
+	mockCmd                = app.Command("mock", "Run a mock Fabric network of peers and an orderer until interrupted")
+	mockPeerNum            = mockCmd.Flag("peers", "Number of peers, belonging to Org1MSP, Org2MSP, and so on").Default("2").Int()
+	mockHost               = mockCmd.Flag("host", "Host to listen on").Default("127.0.0.1").String()
+	mockPeerPort           = mockCmd.Flag("peer-port", "Port of the first peer, the others listen on the following ports").Default("7051").Int()
+	mockOrdererPort        = mockCmd.Flag("orderer-port", "Port of the orderer").Default("7050").Int()
+	mockLatency            = mockCmd.Flag("latency", "Delay of every endorsement and broadcast, e.g. 10ms").Default("0s").Duration()
+	mockEndorseErrorRate   = mockCmd.Flag("endorse-error-rate", "Fraction of proposals failing with status 500").Default("0").Float64()
+	mockBroadcastErrorRate = mockCmd.Flag("broadcast-error-rate", "Fraction of envelopes rejected with status SERVICE_UNAVAILABLE").Default("0").Float64()
+	mockInvalidRate        = mockCmd.Flag("invalid-rate", "Fraction of transactions committed as MVCC_READ_CONFLICT").Default("0").Float64()
+	mockBlockSize          = mockCmd.Flag("block-size", "Maximum number of transactions in a block").Default("10").Int()
+	mockBlockTimeout       = mockCmd.Flag("block-timeout", "Time to wait for more transactions before cutting a block").Default("100ms").Duration()
+	mockTLS                = mockCmd.Flag("tls", "Serve TLS with a self-signed certificate").Bool()
+	mockDir                = mockCmd.Flag("dir", "Folder to write the client identity and the TLS root certificate to").Default("mock").String()
 )
 
 func setLogLevel(logger *log.Logger) {
@@ -37,14 +68,89 @@ func getLogger() *log.Logger {
 	return logger
 }
 
-func getConfig() *infra.Config {
-	config, err := infra.LoadConfigFromFile(*configFile)
+// getOverrides returns the overrides in the environment variables, followed by the ones
+// on the command line, so that the latter take precedence
+func getOverrides(sets []string) ([]infra.Override, error) {
+	overrides := infra.GetEnvOverrides()
+	for _, s := range sets {
+		o, err := infra.ParseOverride(s)
+		if err != nil {
+			return nil, err
+		}
+		overrides = append(overrides, o)
+	}
+	return overrides, nil
+}
+
+func getConfig(filename string, sets []string) *infra.Config {
+	overrides, err := getOverrides(sets)
+	if err != nil {
+		log.Panicf("Fail to parse overrides: %v\n", err)
+	}
+
+	config, err := infra.LoadConfigFromFile(filename, overrides...)
 	if err != nil {
 		log.Panicf("Fail to load config: %v\n", err)
 	}
 	return config
 }
 
+// runMock starts a mock network and writes a client identity which tape can submit transactions with,
+// then blocks until the process is interrupted
+func runMock() error {
+	var peerAddresses []string
+	for i := 0; i < *mockPeerNum; i++ {
+		peerAddresses = append(peerAddresses, net.JoinHostPort(*mockHost, strconv.Itoa(*mockPeerPort+i)))
+	}
+	ordererAddress := net.JoinHostPort(*mockHost, strconv.Itoa(*mockOrdererPort))
+
+	network, err := mock.StartNetwork(peerAddresses, ordererAddress, mock.Options{
+		Latency:            *mockLatency,
+		EndorseErrorRate:   *mockEndorseErrorRate,
+		BroadcastErrorRate: *mockBroadcastErrorRate,
+		InvalidRate:        *mockInvalidRate,
+		BlockSize:          *mockBlockSize,
+		BlockTimeout:       *mockBlockTimeout,
+		TLS:                *mockTLS,
+	})
+	if err != nil {
+		return err
+	}
+	defer network.Stop()
+
+	cert, key, err := mock.NewCertificate("client", nil)
+	if err != nil {
+		return errors.Wrap(err, "fail to create client identity")
+	}
+	files := map[string][]byte{
+		"client.pem": cert,
+		"client_sk":  key,
+	}
+	if *mockTLS {
+		files["tlsca.pem"] = network.TLSCACert
+	}
+	if err = os.MkdirAll(*mockDir, 0755); err != nil {
+		return err
+	}
+	for name, content := range files {
+		if err = ioutil.WriteFile(filepath.Join(*mockDir, name), content, 0600); err != nil {
+			return err
+		}
+	}
+
+	for _, p := range network.Peers {
+		fmt.Printf("Peer %s of %s\n", p.Address(), p.MSPID)
+	}
+	fmt.Printf("Orderer %s\n", network.Orderer.Address())
+	fmt.Printf("Client identity is written to %s, accepted as any MSP\n", *mockDir)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	<-signals
+	fmt.Printf("Stop mock network with %d blocks\n", network.Height())
+	return nil
+}
+
 func main() {
 	var err error
 	logger := getLogger()
@@ -52,8 +158,28 @@ func main() {
 	fullCmd = kingpin.MustParse(app.Parse(os.Args[1:]))
 	switch fullCmd {
 	case run.FullCommand():
-		config := getConfig()
+		if *dryRun {
+			*sets = append(*sets, "dryRun=true")
+		}
+		config := getConfig(*configFile, *sets)
 		infra.Process(config, logger)
+	case validate.FullCommand():
+		overrides, err := getOverrides(*validateSets)
+		if err == nil {
+			_, err = infra.LoadConfigFromFile(*validateConfigFile, overrides...)
+		}
+		if err != nil {
+			fmt.Printf("Config %s is invalid: %v\n", *validateConfigFile, err)
+			os.Exit(1)
+		}
+		fmt.Printf("Config %s is valid\n", *validateConfigFile)
+	case check.FullCommand():
+		config := getConfig(*checkConfigFile, *checkSets)
+		if !infra.Check(config, logger) {
+			os.Exit(1)
+		}
+	case mockCmd.FullCommand():
+		err = runMock()
 	case version.FullCommand():
 		fmt.Printf(infra.GetVersionInfo())
 	default:
@@ -28,6 +28,8 @@ type GRPCClient struct {
 	maxRecvMsgSize int
 	// Maximum message size the client can send
 	maxSendMsgSize int
+	// Compressor applied to all calls
+	compressor string
 }
 
 // NewGRPCClient creates a new implementation of GRPCClient given an address
@@ -57,9 +59,24 @@ func NewGRPCClient(config ClientConfig) (*GRPCClient, error) {
 	}
 	client.timeout = config.Timeout
 
-	// set send/recv message size to package defaults
+	// flow control windows
+	if config.InitialWindowSize > 0 {
+		client.dialOpts = append(client.dialOpts, grpc.WithInitialWindowSize(config.InitialWindowSize))
+	}
+	if config.InitialConnWindowSize > 0 {
+		client.dialOpts = append(client.dialOpts, grpc.WithInitialConnWindowSize(config.InitialConnWindowSize))
+	}
+
+	// set send/recv message size to package defaults unless configured
 	client.maxRecvMsgSize = MaxRecvMsgSize
+	if config.MaxRecvMsgSize > 0 {
+		client.maxRecvMsgSize = config.MaxRecvMsgSize
+	}
 	client.maxSendMsgSize = MaxSendMsgSize
+	if config.MaxSendMsgSize > 0 {
+		client.maxSendMsgSize = config.MaxSendMsgSize
+	}
+	client.compressor = config.Compressor
 
 	return client, nil
 }
@@ -196,10 +213,14 @@ func (client *GRPCClient) NewConnection(address string, tlsOptions ...TLSOption)
 		dialOpts = append(dialOpts, grpc.WithInsecure())
 	}
 
-	dialOpts = append(dialOpts, grpc.WithDefaultCallOptions(
+	callOpts := []grpc.CallOption{
 		grpc.MaxCallRecvMsgSize(client.maxRecvMsgSize),
 		grpc.MaxCallSendMsgSize(client.maxSendMsgSize),
-	))
+	}
+	if client.compressor != "" {
+		callOpts = append(callOpts, grpc.UseCompressor(client.compressor))
+	}
+	dialOpts = append(dialOpts, grpc.WithDefaultCallOptions(callOpts...))
 
 	ctx, cancel := context.WithTimeout(context.Background(), client.timeout)
 	defer cancel()
@@ -77,6 +77,21 @@ type ClientConfig struct {
 	Timeout time.Duration
 	// AsyncConnect makes connection creation non blocking
 	AsyncConnect bool
+	// MaxRecvMsgSize is the maximum message size the client can receive,
+	// the package default is used if zero
+	MaxRecvMsgSize int
+	// MaxSendMsgSize is the maximum message size the client can send,
+	// the package default is used if zero
+	MaxSendMsgSize int
+	// Compressor is the name of the compressor applied to all calls, e.g. "gzip",
+	// no compression if empty
+	Compressor string
+	// InitialWindowSize is the initial window size of a stream,
+	// the gRPC default is used if zero
+	InitialWindowSize int32
+	// InitialConnWindowSize is the initial window size of a connection,
+	// the gRPC default is used if zero
+	InitialConnWindowSize int32
 }
 
 // Clone clones this ClientConfig
@@ -0,0 +1,193 @@
+package infra
+
+import (
+	"github.com/golang/protobuf/proto"
+	"github.com/osdi23p228/fabric-protos-go/common"
+	"github.com/osdi23p228/fabric-protos-go/peer"
+	"github.com/osdi23p228/fabric/protoutil"
+	"github.com/pkg/errors"
+)
+
+// ObservedBlock contains the information of a delivered block that the observer cares about,
+// no matter whether it is a filtered block or a full block
+type ObservedBlock struct {
+	Number       uint64
+	Transactions []*ObservedTransaction
+	Stats        *BlockStats // only available for full blocks
+}
+
+// ObservedTransaction contains the information of a transaction within a delivered block
+type ObservedTransaction struct {
+	Txid           string
+	ValidationCode peer.TxValidationCode
+	EnvelopeSize   int // only available for full blocks
+	RWSetSize      int // only available for full blocks
+	Events         []*peer.ChaincodeEvent
+}
+
+// BlockStats contains the size information of a full block
+type BlockStats struct {
+	Size          int      // size of the whole block in bytes
+	MetadataSize  int      // size of the block metadata in bytes
+	SignatureSize int      // total size of the orderer signatures in bytes
+	Signers       []string // MSP IDs of the orderers signing the block
+	Unparsed      int      // number of transactions whose txids fail to be parsed
+}
+
+func parseFilteredBlock(fb *peer.FilteredBlock) *ObservedBlock {
+	ob := &ObservedBlock{
+		Number:       fb.Number,
+		Transactions: make([]*ObservedTransaction, len(fb.FilteredTransactions)),
+	}
+
+	for i, tx := range fb.FilteredTransactions {
+		ob.Transactions[i] = &ObservedTransaction{
+			Txid:           tx.GetTxid(),
+			ValidationCode: tx.TxValidationCode,
+		}
+
+		// Filtered events carry no payload
+		for _, action := range tx.GetTransactionActions().GetChaincodeActions() {
+			if event := action.GetChaincodeEvent(); event != nil {
+				ob.Transactions[i].Events = append(ob.Transactions[i].Events, event)
+			}
+		}
+	}
+
+	return ob
+}
+
+// parseBlock extracts the transactions and the size information from a full block.
+// A transaction that fails to be parsed is logged, and counted in the stats if even its txid is unknown
+func parseBlock(block *common.Block) *ObservedBlock {
+	ob := &ObservedBlock{
+		Number: block.GetHeader().GetNumber(),
+		Stats: &BlockStats{
+			Size:         proto.Size(block),
+			MetadataSize: proto.Size(block.GetMetadata()),
+		},
+	}
+
+	var txFilter []byte
+	if metadata := block.GetMetadata().GetMetadata(); len(metadata) > int(common.BlockMetadataIndex_TRANSACTIONS_FILTER) {
+		txFilter = metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER]
+	}
+	for i, data := range block.GetData().GetData() {
+		tx, err := parseTransaction(data)
+		if err != nil {
+			logger.Errorf("Fail to parse No. %d transaction in block %d: %v", i, ob.Number, err)
+			if tx == nil {
+				ob.Stats.Unparsed++
+				continue
+			}
+		}
+
+		tx.ValidationCode = peer.TxValidationCode_NOT_VALIDATED
+		if i < len(txFilter) {
+			tx.ValidationCode = peer.TxValidationCode(txFilter[i])
+		}
+		ob.Transactions = append(ob.Transactions, tx)
+	}
+
+	signers, signatureSize, err := getBlockSigners(block)
+	if err != nil {
+		logger.Errorf("Fail to get signers of block %d: %v", ob.Number, err)
+	}
+	ob.Stats.Signers = signers
+	ob.Stats.SignatureSize = signatureSize
+
+	return ob
+}
+
+// parseTransaction extracts the information of a transaction from its envelope.
+// Once the txid is parsed, the transaction is returned along with any later error
+func parseTransaction(data []byte) (*ObservedTransaction, error) {
+	envelope, err := protoutil.GetEnvelopeFromBlock(data)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := protoutil.UnmarshalPayload(envelope.Payload)
+	if err != nil {
+		return nil, err
+	}
+	if payload.Header == nil {
+		return nil, errors.New("missing payload header")
+	}
+
+	channelHeader, err := protoutil.UnmarshalChannelHeader(payload.Header.ChannelHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := &ObservedTransaction{
+		Txid:         channelHeader.TxId,
+		EnvelopeSize: len(data),
+	}
+
+	// Only endorser transactions carry a read-write set
+	if common.HeaderType(channelHeader.Type) == common.HeaderType_ENDORSER_TRANSACTION {
+		ccAction, err := protoutil.GetActionFromEnvelope(data)
+		if err != nil {
+			return tx, err
+		}
+		tx.RWSetSize = len(ccAction.Results)
+
+		if len(ccAction.Events) > 0 {
+			event, err := protoutil.UnmarshalChaincodeEvents(ccAction.Events)
+			if err != nil {
+				return tx, err
+			}
+			tx.Events = append(tx.Events, event)
+		}
+	}
+
+	return tx, nil
+}
+
+// getBlockSigners returns the MSP IDs of the orderers signing the block
+// and the total size of their signatures
+func getBlockSigners(block *common.Block) ([]string, int, error) {
+	if block.GetMetadata() == nil {
+		return nil, 0, errors.New("no metadata in block")
+	}
+
+	metadata, err := protoutil.GetMetadataFromBlock(block, common.BlockMetadataIndex_SIGNATURES)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var signers []string
+	signatureSize := 0
+	for _, signature := range metadata.Signatures {
+		signatureSize += len(signature.Signature)
+
+		signatureHeader, err := protoutil.UnmarshalSignatureHeader(signature.SignatureHeader)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		identity, err := protoutil.UnmarshalSerializedIdentity(signatureHeader.Creator)
+		if err != nil {
+			return nil, 0, err
+		}
+		signers = append(signers, identity.Mspid)
+	}
+
+	return signers, signatureSize, nil
+}
+
+// parseDeliverResponse converts a block of any deliver type into an ObservedBlock.
+// It returns nil if the response does not contain a block
+func parseDeliverResponse(resp *peer.DeliverResponse) *ObservedBlock {
+	switch t := resp.Type.(type) {
+	case *peer.DeliverResponse_FilteredBlock:
+		return parseFilteredBlock(t.FilteredBlock)
+	case *peer.DeliverResponse_Block:
+		return parseBlock(t.Block)
+	case *peer.DeliverResponse_BlockAndPrivateData:
+		return parseBlock(t.BlockAndPrivateData.GetBlock())
+	default:
+		return nil
+	}
+}
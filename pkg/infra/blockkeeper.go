@@ -0,0 +1,165 @@
+package infra
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	blockKeepers BlockKeepers
+)
+
+// BlockKeepers records the size information of the full blocks observed during the run
+type BlockKeepers struct {
+	blocks  []*BlockKeeper
+	lock    sync.Mutex // guards the blocks, which are no longer appended once stopped
+	stopped bool
+}
+
+type BlockKeeper struct {
+	Number        uint64
+	ObservedTime  int64
+	TxNum         int
+	Size          int
+	EnvelopeSize  int // total size of all envelopes
+	RWSetSize     int // total size of all read-write sets
+	MetadataSize  int
+	SignatureSize int
+	Signers       []string
+	Unparsed      int // number of transactions whose txids fail to be parsed
+}
+
+func initBlockKeepers() {
+	blockKeepers = BlockKeepers{}
+}
+
+func (bks *BlockKeepers) keepBlock(block *ObservedBlock) {
+	if block.Stats == nil {
+		return
+	}
+
+	observedTime := time.Now().UnixNano()
+
+	bk := &BlockKeeper{
+		Number:        block.Number,
+		ObservedTime:  observedTime,
+		TxNum:         len(block.Transactions),
+		Size:          block.Stats.Size,
+		MetadataSize:  block.Stats.MetadataSize,
+		SignatureSize: block.Stats.SignatureSize,
+		Signers:       block.Stats.Signers,
+		Unparsed:      block.Stats.Unparsed,
+	}
+	for _, tx := range block.Transactions {
+		bk.EnvelopeSize += tx.EnvelopeSize
+		bk.RWSetSize += tx.RWSetSize
+	}
+
+	bks.lock.Lock()
+	defer bks.lock.Unlock()
+	if bks.stopped {
+		return
+	}
+
+	logCh <- fmt.Sprintf("%-10s %d %4d %d %d", "Block", observedTime, bk.Number, bk.TxNum, bk.Size)
+
+	bks.blocks = append(bks.blocks, bk)
+}
+
+// stop stops appending blocks, so that they can be reported while the observer is still running
+func (bks *BlockKeepers) stop() {
+	bks.lock.Lock()
+	defer bks.lock.Unlock()
+
+	bks.stopped = true
+}
+
+func (bks *BlockKeepers) getUnparsedNum() int {
+	total := 0
+	for _, bk := range bks.blocks {
+		total += bk.Unparsed
+	}
+	return total
+}
+
+func (bks *BlockKeepers) getAverageBlockSize() float64 {
+	if len(bks.blocks) == 0 {
+		return 0
+	}
+
+	total := 0
+	for _, bk := range bks.blocks {
+		total += bk.Size
+	}
+	return float64(total) / float64(len(bks.blocks))
+}
+
+func (bks *BlockKeepers) getAverageTxNum() float64 {
+	if len(bks.blocks) == 0 {
+		return 0
+	}
+
+	total := 0
+	for _, bk := range bks.blocks {
+		total += bk.TxNum
+	}
+	return float64(total) / float64(len(bks.blocks))
+}
+
+func (bks *BlockKeepers) getAverageEnvelopeSize() float64 {
+	txNum, total := 0, 0
+	for _, bk := range bks.blocks {
+		txNum += bk.TxNum
+		total += bk.EnvelopeSize
+	}
+	if txNum == 0 {
+		return 0
+	}
+	return float64(total) / float64(txNum)
+}
+
+func (bks *BlockKeepers) getAverageRWSetSize() float64 {
+	txNum, total := 0, 0
+	for _, bk := range bks.blocks {
+		txNum += bk.TxNum
+		total += bk.RWSetSize
+	}
+	if txNum == 0 {
+		return 0
+	}
+	return float64(total) / float64(txNum)
+}
+
+// report sends the block statistics to the report file
+func (bks *BlockKeepers) report() {
+	reportCh <- fmt.Sprintf("Blocks: %d", len(bks.blocks))
+	reportCh <- fmt.Sprintf("Average Block Size: %.0fB", bks.getAverageBlockSize())
+	reportCh <- fmt.Sprintf("Average Transactions per Block: %.2f", bks.getAverageTxNum())
+	reportCh <- fmt.Sprintf("Average Envelope Size: %.0fB", bks.getAverageEnvelopeSize())
+	reportCh <- fmt.Sprintf("Average RWSet Size: %.0fB", bks.getAverageRWSetSize())
+	reportCh <- fmt.Sprintf("Unparsed Transactions: %d", bks.getUnparsedNum())
+
+	reportCh <- fmt.Sprintf("block   txs  interval(ms)    size(B) envelope(B)  rwset(B) metadata(B) signature(B) signers")
+	var lastObservedTime int64
+	for _, bk := range bks.blocks {
+		interval := 0.0
+		if lastObservedTime != 0 {
+			interval = float64(bk.ObservedTime-lastObservedTime) / float64(1e6)
+		}
+		lastObservedTime = bk.ObservedTime
+
+		reportCh <- fmt.Sprintf("%-7d %4d %13.2f %10d %11d %9d %11d %12d %s",
+			bk.Number,
+			bk.TxNum,
+			interval,
+			bk.Size,
+			bk.EnvelopeSize,
+			bk.RWSetSize,
+			bk.MetadataSize,
+			bk.SignatureSize,
+			strings.Join(bk.Signers, ","),
+		)
+	}
+}
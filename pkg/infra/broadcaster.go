@@ -1,11 +1,21 @@
 package infra
 
 import (
+	"context"
 	"io"
+	"sync"
 	"time"
 
 	"github.com/osdi23p228/fabric-protos-go/common"
+	"github.com/osdi23p228/fabric-protos-go/gateway"
 	"github.com/osdi23p228/fabric-protos-go/orderer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	broadcasterMinBackoff = 100 * time.Millisecond
+	broadcasterMaxBackoff = 10 * time.Second
 )
 
 type Broadcasters struct {
@@ -23,18 +33,32 @@ func NewBroadcasters(inCh <-chan *Element) *Broadcasters {
 	expectTPS := float64(config.Rate) / float64(config.BroadcasterNum)
 
 	for i := 0; i < config.BroadcasterNum; i++ {
-		client, err := CreateBroadcastClient(config.Orderer)
-		if err != nil {
-			logger.Fatalf("Fail to create connection for the No. %d broadcaster: %v", i, err)
-		}
-
-		bs.broadcasters[i] = &Broadcaster{
-			client:           client,
+		b := &Broadcaster{
 			broadcasterIndex: i,
 			expectTPS:        expectTPS,
 			inCh:             inCh,
 			tokenCh:          bs.tokenCh,
 		}
+
+		var err error
+		if config.Mode == ModeGateway {
+			b.address = config.Gateway.Address
+			b.gatewayClient, err = CreateGatewayClient(config.Gateway)
+		} else {
+			b.address = config.Orderer.Address
+			var client orderer.AtomicBroadcast_BroadcastClient
+			var conn *grpc.ClientConn
+			client, conn, err = CreateBroadcastClient(config.Orderer)
+			if err == nil {
+				b.stream = &broadcastStream{client: client, conn: conn}
+				faultKeepers.addReconnector(b.address, b.redial)
+			}
+		}
+		if err != nil {
+			logger.Fatalf("Fail to create connection for the No. %d broadcaster: %v", i, err)
+		}
+
+		bs.broadcasters[i] = b
 	}
 
 	return bs
@@ -47,7 +71,11 @@ func (bs *Broadcasters) StartAsync() {
 
 	// Start multiple goroutines to send envelopes
 	for _, b := range bs.broadcasters {
-		go b.receive()
+		if b.gatewayClient != nil {
+			go b.submit()
+			continue
+		}
+		go b.receive(b.stream)
 		go b.send()
 	}
 }
@@ -67,13 +95,69 @@ func (bs *Broadcasters) generateTokens() {
 }
 
 type Broadcaster struct {
-	client           orderer.AtomicBroadcast_BroadcastClient
+	stream           *broadcastStream      // replaced whenever the connection is re-dialed
+	lock             sync.Mutex            // guards the stream
+	gatewayClient    gateway.GatewayClient // only used in 'gateway' mode
+	address          string                // address of the orderer, or the gateway in 'gateway' mode
 	broadcasterIndex int
 	expectTPS        float64
 	inCh             <-chan *Element
 	tokenCh          chan struct{}
 }
 
+// broadcastStream is a broadcast stream along with the envelopes sent through it and not acknowledged yet,
+// since the orderer acknowledges the envelopes of a stream in order
+type broadcastStream struct {
+	client  orderer.AtomicBroadcast_BroadcastClient
+	conn    *grpc.ClientConn
+	lock    sync.Mutex
+	pending []pendingEnvelope
+}
+
+type pendingEnvelope struct {
+	txid      string
+	duplicate bool // whether it is a copy broadcast as a fault
+}
+
+func (s *broadcastStream) push(e pendingEnvelope) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.pending = append(s.pending, e)
+}
+
+func (s *broadcastStream) pop() (pendingEnvelope, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if len(s.pending) == 0 {
+		return pendingEnvelope{}, false
+	}
+	e := s.pending[0]
+	s.pending = s.pending[1:]
+	return e, true
+}
+
+// unpush removes the envelope pushed last, whose sending fails
+func (s *broadcastStream) unpush() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if len(s.pending) > 0 {
+		s.pending = s.pending[:len(s.pending)-1]
+	}
+}
+
+// drain removes and returns all pending envelopes
+func (s *broadcastStream) drain() []pendingEnvelope {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	pending := s.pending
+	s.pending = nil
+	return pending
+}
+
 func (b *Broadcaster) getToken() {
 	<-b.tokenCh
 }
@@ -89,29 +173,170 @@ func (b *Broadcaster) send() {
 
 			timeKeepers.keepBroadcastTime(element.Txid, b.broadcasterIndex)
 
-			err := b.client.Send(element.Envelope)
-			if err != nil {
-				logger.Fatalln(err)
+			envelope, duplicate := b.injectFaults(element)
+			b.broadcast(envelope, pendingEnvelope{txid: element.Txid})
+			if duplicate {
+				b.broadcast(envelope, pendingEnvelope{txid: element.Txid, duplicate: true})
+			}
+		case <-doneCh:
+			b.lock.Lock()
+			b.stream.client.CloseSend()
+			b.lock.Unlock()
+			return
+		}
+	}
+}
+
+// broadcast sends the envelope through the current stream. The envelope is aborted if it fails to be sent,
+// e.g. because the stream is closed by a reconnect fault which fails to re-dial before the run ends
+func (b *Broadcaster) broadcast(envelope *common.Envelope, e pendingEnvelope) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.stream.push(e)
+	if err := b.stream.client.Send(envelope); err != nil {
+		b.stream.unpush()
+		rejectEnvelope(e, status.Code(err).String(), err.Error())
+	}
+}
+
+// redial closes the stream and its connection, and dials a new one on behalf of the fault
+// with exponential backoff, until the run ends. The envelopes whose acknowledgements are not
+// received yet may never reach the orderer, so they are aborted as hit by the fault.
+// Broadcasting waits for the new stream meanwhile
+func (b *Broadcaster) redial(fk *FaultKeeper) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	lost := b.stream
+	lost.conn.Close()
+	defer func() {
+		for _, e := range lost.drain() {
+			faultKeepers.keepHit(fk, e.txid)
+			rejectEnvelope(e, "REDIALED", "connection is killed before the acknowledgement is received")
+		}
+	}()
+
+	backoff := broadcasterMinBackoff
+	for {
+		client, conn, err := CreateBroadcastClient(config.Orderer)
+		if err == nil {
+			b.stream = &broadcastStream{client: client, conn: conn}
+			go b.receive(b.stream)
+			return nil
+		}
+		logger.Warnf("Fail to re-dial orderer %s: %v, retry in %v", config.Orderer.Address, err, backoff)
+
+		select {
+		case <-doneCh:
+			return err
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > broadcasterMaxBackoff {
+			backoff = broadcasterMaxBackoff
+		}
+	}
+}
+
+// injectFaults applies the broadcast faults hitting the element. It returns the envelope to be broadcast
+// and whether the envelope is broadcast twice
+func (b *Broadcaster) injectFaults(element *Element) (*common.Envelope, bool) {
+	if fk := faultKeepers.inject(FaultDelayBroadcast, b.address, element.Txid); fk != nil {
+		time.Sleep(time.Duration(fk.Delay) * time.Millisecond)
+	}
+
+	envelope := element.Envelope
+	if faultKeepers.inject(FaultBadSignature, b.address, element.Txid) != nil {
+		envelope = corruptSignature(envelope)
+	}
+
+	duplicate := faultKeepers.inject(FaultDuplicateTxid, b.address, element.Txid) != nil
+	return envelope, duplicate
+}
+
+// submit collects and submits envelopes through the gateway, which waits for
+// the orderer to accept each of them
+func (b *Broadcaster) submit() {
+	logger.Infof("Start submitting")
+
+	for {
+		select {
+		case element := <-b.inCh:
+			b.getToken()
+
+			timeKeepers.keepBroadcastTime(element.Txid, b.broadcasterIndex)
+
+			envelope, duplicate := b.injectFaults(element)
+			if err := b.submitEnvelope(element.Txid, envelope); err != nil {
+				rejectEnvelope(pendingEnvelope{txid: element.Txid}, status.Code(err).String(), err.Error())
+				continue
+			}
+			if duplicate {
+				if err := b.submitEnvelope(element.Txid, envelope); err != nil {
+					rejectEnvelope(pendingEnvelope{txid: element.Txid, duplicate: true}, status.Code(err).String(), err.Error())
+				}
+			}
+
+			if config.CommitStatus {
+				submittedCh <- element
 			}
 		case <-doneCh:
-			b.client.CloseSend()
 			return
 		}
 	}
 }
 
-func (b *Broadcaster) receive() {
+func (b *Broadcaster) submitEnvelope(txid string, envelope *common.Envelope) error {
+	_, err := b.gatewayClient.Submit(context.Background(), &gateway.SubmitRequest{
+		TransactionId:       txid,
+		ChannelId:           config.Channel,
+		PreparedTransaction: envelope,
+	})
+	return err
+}
+
+// receive receives the acknowledgements of the envelopes sent through the stream until it ends
+func (b *Broadcaster) receive(s *broadcastStream) {
 	for {
-		res, err := b.client.Recv()
+		res, err := s.client.Recv()
 		if err != nil {
-			if err != io.EOF {
+			if err != io.EOF && !b.isRedialed(s) {
 				logger.Errorf("Recieve broadcast error: %+v, status: %+v\n", err, res)
 			}
 			return
 		}
 
+		e, ok := s.pop()
+		if !ok {
+			logger.Errorf("Receive an unexpected broadcast response with status %s", res.Status)
+			continue
+		}
 		if res.Status != common.Status_SUCCESS {
-			logger.Fatalf("Receive error status %s", res.Status)
+			rejectEnvelope(e, res.Status.String(), res.Info)
 		}
 	}
 }
+
+// isRedialed returns true if the stream has been replaced by a new one
+func (b *Broadcaster) isRedialed(s *broadcastStream) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.stream != s
+}
+
+// rejectEnvelope aborts the transaction whose envelope is rejected by the orderer or the gateway,
+// unless the envelope is a duplicated copy
+func rejectEnvelope(e pendingEnvelope, reason string, info string) {
+	faultKeepers.keepReaction(e.txid, reason)
+	if e.duplicate {
+		logger.Debugf("Duplicated envelope of transaction %s is rejected with %s: %s", e.txid, reason, info)
+		return
+	}
+
+	logger.Errorf("Envelope of transaction %s is rejected with %s: %s", e.txid, reason, info)
+	Metric.AddAbort()
+	timeKeepers.keepAbortedTime(e.txid)
+}
@@ -0,0 +1,231 @@
+package infra
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/osdi23p228/fabric-protos-go/gateway"
+	"github.com/osdi23p228/fabric-protos-go/orderer"
+	"github.com/osdi23p228/fabric-protos-go/peer"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	checkTimeout = 30 * time.Second
+)
+
+// CheckResult is the outcome of one check against a node
+type CheckResult struct {
+	Role    string // role of the node, e.g. "endorser 0"
+	Address string
+	Check   string // what is checked, e.g. "connect" or "endorse as default"
+	Err     error  // nil if the check passes
+}
+
+// checkProposal is a signed proposal of an identity, sent to the endorsers for checking
+type checkProposal struct {
+	identity       string
+	txid           string
+	signedProposal *peer.SignedProposal
+}
+
+// Check dials every node the run talks to, performing the TLS handshake, and makes sure that
+// the client is allowed to use it, i.e. the endorsers endorse a proposal of each identity
+// and the committer and orderer deliver the newest block of the channel.
+// It prints a table of the results and returns false if any check fails
+func Check(c *Config, l *log.Logger) bool {
+	config = c
+	logger = l
+
+	proposals, err := createCheckProposals()
+	if err != nil {
+		logger.Errorf("Fail to create proposals for checking: %v", err)
+		return false
+	}
+
+	var results []CheckResult
+	switch config.Mode {
+	case ModeGateway:
+		results = append(results, checkGateway("gateway", config.Gateway, proposals)...)
+		if !config.CommitStatus {
+			results = append(results, checkCommitter("committer", config.Committer)...)
+		}
+	default:
+		for i, endorser := range config.Endorsers {
+			results = append(results, checkEndorser(fmt.Sprintf("endorser %d", i), endorser, proposals)...)
+		}
+		results = append(results, checkCommitter("committer", config.Committer)...)
+		results = append(results, checkOrderer("orderer", config.Orderer)...)
+	}
+
+	passed := true
+	fmt.Printf("%-12s %-32s %-28s %s\n", "role", "address", "check", "result")
+	for _, r := range results {
+		result := "PASS"
+		if r.Err != nil {
+			result = fmt.Sprintf("FAIL: %v", r.Err)
+			passed = false
+		}
+		fmt.Printf("%-12s %-32s %-28s %s\n", r.Role, r.Address, r.Check, result)
+	}
+	return passed
+}
+
+// createCheckProposals creates a proposal of the workload for each identity
+func createCheckProposals() ([]checkProposal, error) {
+	// A workload of its own, so that nothing generated here is recorded as part of the run
+	workload := workloads[config.TxType]()
+	if err := workload.Init(config); err != nil {
+		return nil, err
+	}
+
+	initSeed()
+	invocation, err := workload.Next()
+	if err != nil {
+		return nil, err
+	}
+	chaincode, version := invocation.chaincode()
+
+	var proposals []checkProposal
+	for _, identity := range config.ClientIdentities {
+		proposal, txid, err := CreateProposal(identity.Crypto, "", config.Channel, chaincode, version, invocation.ccArgs(), invocation.Transient)
+		if err != nil {
+			return nil, err
+		}
+
+		signedProposal, err := SignProposal(identity.Crypto, proposal)
+		if err != nil {
+			return nil, err
+		}
+
+		proposals = append(proposals, checkProposal{
+			identity:       identity.Name,
+			txid:           txid,
+			signedProposal: signedProposal,
+		})
+	}
+	return proposals, nil
+}
+
+func checkEndorser(role string, node Node, proposals []checkProposal) []CheckResult {
+	conn, err := DialConnection(node)
+	results := []CheckResult{{Role: role, Address: node.Address, Check: "connect", Err: err}}
+	if err != nil {
+		return results
+	}
+	defer conn.Close()
+
+	client := peer.NewEndorserClient(conn)
+	for _, p := range proposals {
+		ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+		_, err := processProposal(ctx, client, p.signedProposal)
+		cancel()
+		results = append(results, CheckResult{Role: role, Address: node.Address, Check: "endorse as " + p.identity, Err: err})
+	}
+	return results
+}
+
+// checkGateway evaluates the proposals through the gateway, which runs the chaincode
+// without committing the transactions
+func checkGateway(role string, node Node, proposals []checkProposal) []CheckResult {
+	conn, err := DialConnection(node)
+	results := []CheckResult{{Role: role, Address: node.Address, Check: "connect", Err: err}}
+	if err != nil {
+		return results
+	}
+	defer conn.Close()
+
+	client := gateway.NewGatewayClient(conn)
+	for _, p := range proposals {
+		ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+		resp, err := client.Evaluate(ctx, &gateway.EvaluateRequest{
+			TransactionId:       p.txid,
+			ChannelId:           config.Channel,
+			ProposedTransaction: p.signedProposal,
+		})
+		cancel()
+		if err == nil && (resp.Result.Status < 200 || resp.Result.Status >= 400) {
+			err = errors.Errorf("status: %d, message: %s", resp.Result.Status, resp.Result.Message)
+		}
+		results = append(results, CheckResult{Role: role, Address: node.Address, Check: "evaluate as " + p.identity, Err: err})
+	}
+	return results
+}
+
+func checkCommitter(role string, node Node) []CheckResult {
+	conn, err := DialConnection(node)
+	results := []CheckResult{{Role: role, Address: node.Address, Check: "connect", Err: err}}
+	if err != nil {
+		return results
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+	defer cancel()
+
+	err = func() error {
+		envelope, err := CreateSignedSeekNewestEnv()
+		if err != nil {
+			return err
+		}
+
+		deliverer, err := newDeliverClient(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err = deliverer.Send(envelope); err != nil {
+			return err
+		}
+
+		resp, err := deliverer.Recv()
+		if err != nil {
+			return err
+		}
+		if s, ok := resp.Type.(*peer.DeliverResponse_Status); ok {
+			return errors.Errorf("status: %s", s.Status)
+		}
+		return nil
+	}()
+	return append(results, CheckResult{Role: role, Address: node.Address, Check: "deliver " + config.DeliverType, Err: err})
+}
+
+// checkOrderer reads the newest block from the orderer, since broadcasting a transaction
+// for checking would commit it
+func checkOrderer(role string, node Node) []CheckResult {
+	conn, err := DialConnection(node)
+	results := []CheckResult{{Role: role, Address: node.Address, Check: "connect", Err: err}}
+	if err != nil {
+		return results
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+	defer cancel()
+
+	err = func() error {
+		envelope, err := CreateSignedSeekNewestEnv()
+		if err != nil {
+			return err
+		}
+
+		deliverer, err := orderer.NewAtomicBroadcastClient(conn).Deliver(ctx)
+		if err != nil {
+			return err
+		}
+		if err = deliverer.Send(envelope); err != nil {
+			return err
+		}
+
+		resp, err := deliverer.Recv()
+		if err != nil {
+			return err
+		}
+		if s, ok := resp.Type.(*orderer.DeliverResponse_Status); ok {
+			return errors.Errorf("status: %s", s.Status)
+		}
+		return nil
+	}()
+	return append(results, CheckResult{Role: role, Address: node.Address, Check: "deliver", Err: err})
+}
@@ -3,13 +3,17 @@ package infra
 import (
 	"context"
 	"crypto/tls"
+	"sync"
 	"time"
 
+	"github.com/osdi23p228/fabric-protos-go/common"
+	"github.com/osdi23p228/fabric-protos-go/gateway"
 	"github.com/osdi23p228/fabric-protos-go/orderer"
 	"github.com/osdi23p228/fabric-protos-go/peer"
 	"github.com/osdi23p228/tape/pkg/comm"
 	"github.com/pkg/errors"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding/gzip"
 )
 
 const (
@@ -30,8 +34,35 @@ func newGRPCClient(node Node) (*comm.GRPCClient, error) {
 func generateClientConfig(node Node) comm.ClientConfig {
 	certs := collectTLSCACertsBytes(node)
 
+	opts := node.GRPC
+	connectTimeout := time.Duration(opts.ConnectTimeout) * time.Millisecond
+	if connectTimeout == 0 {
+		connectTimeout = defaultConnectTimeout * time.Millisecond
+	}
+
+	// Keepalive pings are always sent, even without any active stream. Unless configured,
+	// gRPC pings every 10s, its minimum interval, and waits 20s for the ack
+	keepalive := comm.KeepaliveOptions{}
+	if opts.KeepaliveInterval > 0 {
+		keepalive.ClientInterval = time.Duration(opts.KeepaliveInterval) * time.Second
+	}
+	if opts.KeepaliveTimeout > 0 {
+		keepalive.ClientTimeout = time.Duration(opts.KeepaliveTimeout) * time.Second
+	}
+
+	var compressor string
+	if opts.Compression == CompressionGzip {
+		compressor = gzip.Name
+	}
+
 	clientConfig := comm.ClientConfig{
-		Timeout: 30 * time.Second,
+		Timeout:               connectTimeout,
+		KaOpts:                keepalive,
+		MaxRecvMsgSize:        opts.MaxRecvMsgSize,
+		MaxSendMsgSize:        opts.MaxSendMsgSize,
+		Compressor:            compressor,
+		InitialWindowSize:     opts.InitialWindowSize,
+		InitialConnWindowSize: opts.InitialConnWindowSize,
 		SecOpts: comm.SecureOptions{
 			UseTLS:            false,
 			RequireClientCert: false,
@@ -41,13 +72,10 @@ func generateClientConfig(node Node) comm.ClientConfig {
 
 	if len(certs) > 0 {
 		clientConfig.SecOpts.UseTLS = true
-		if len(node.TLSCAKey) > 0 && len(node.TLSCARoot) > 0 {
+		if node.TLSClientCertByte != nil {
 			clientConfig.SecOpts.RequireClientCert = true
-			clientConfig.SecOpts.Certificate = node.TLSCACertByte
-			clientConfig.SecOpts.Key = node.TLSCAKeyByte
-			if node.TLSCARootByte != nil {
-				clientConfig.SecOpts.ClientRootCAs = append(clientConfig.SecOpts.ClientRootCAs, node.TLSCARootByte)
-			}
+			clientConfig.SecOpts.Certificate = node.TLSClientCertByte
+			clientConfig.SecOpts.Key = node.TLSClientKeyByte
 		}
 	}
 
@@ -59,6 +87,7 @@ func collectTLSCACertsBytes(node Node) [][]byte {
 	if node.TLSCACertByte != nil {
 		certs = append(certs, node.TLSCACertByte)
 	}
+	certs = append(certs, node.TLSCACertsByte...)
 	return certs
 }
 
@@ -70,20 +99,131 @@ func CreateEndorserClient(node Node) (peer.EndorserClient, error) {
 	return peer.NewEndorserClient(conn), nil
 }
 
-func CreateBroadcastClient(node Node) (orderer.AtomicBroadcast_BroadcastClient, error) {
+func CreateGatewayClient(node Node) (gateway.GatewayClient, error) {
 	conn, err := DialConnection(node)
 	if err != nil {
 		return nil, err
 	}
-	return orderer.NewAtomicBroadcastClient(conn).Broadcast(context.Background())
+	return gateway.NewGatewayClient(conn), nil
 }
 
-func CreateDeliverFilteredClient() (peer.Deliver_DeliverFilteredClient, error) {
-	conn, err := DialConnection(config.Committer)
+// CreateBroadcastClient creates a broadcast stream to the orderer.
+// It also returns the underlying connection so that the caller is able to close it before re-dialing
+func CreateBroadcastClient(node Node) (orderer.AtomicBroadcast_BroadcastClient, *grpc.ClientConn, error) {
+	conn, err := DialConnection(node)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	client, err := orderer.NewAtomicBroadcastClient(conn).Broadcast(context.Background())
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return client, conn, nil
+}
+
+// redialEndorserClient is an endorser client whose connection can be killed and re-dialed during a run
+type redialEndorserClient struct {
+	node         Node
+	lock         sync.RWMutex
+	conn         *grpc.ClientConn
+	client       peer.EndorserClient
+	inflightLock sync.Mutex
+	inflight     map[*peer.SignedProposal]bool // proposals whose responses are not received yet
+}
+
+func newRedialEndorserClient(node Node) (*redialEndorserClient, error) {
+	conn, err := DialConnection(node)
 	if err != nil {
 		return nil, err
 	}
-	return peer.NewDeliverClient(conn).DeliverFiltered(context.Background())
+	return &redialEndorserClient{
+		node:     node,
+		conn:     conn,
+		client:   peer.NewEndorserClient(conn),
+		inflight: make(map[*peer.SignedProposal]bool),
+	}, nil
+}
+
+func (c *redialEndorserClient) ProcessProposal(ctx context.Context, in *peer.SignedProposal, opts ...grpc.CallOption) (*peer.ProposalResponse, error) {
+	c.lock.RLock()
+	client := c.client
+	c.lock.RUnlock()
+
+	c.inflightLock.Lock()
+	c.inflight[in] = true
+	c.inflightLock.Unlock()
+	defer func() {
+		c.inflightLock.Lock()
+		delete(c.inflight, in)
+		c.inflightLock.Unlock()
+	}()
+
+	return client.ProcessProposal(ctx, in, opts...)
+}
+
+// redial closes the connection, failing the requests in flight, and dials a new one on behalf of the fault.
+// The transactions of the requests in flight are hit by the fault with the reaction REDIALED
+func (c *redialEndorserClient) redial(fk *FaultKeeper) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.inflightLock.Lock()
+	for signedProposal := range c.inflight {
+		txid, err := getProposalTxid(signedProposal)
+		if err != nil {
+			logger.Errorf("Fail to get the txid of a proposal in flight to %s: %v", c.node.Address, err)
+			continue
+		}
+		faultKeepers.keepHit(fk, txid)
+		faultKeepers.keepReaction(txid, "REDIALED")
+	}
+	c.inflightLock.Unlock()
+
+	c.conn.Close()
+	conn, err := DialConnection(c.node)
+	if err != nil {
+		return err
+	}
+	c.conn = conn
+	c.client = peer.NewEndorserClient(conn)
+	return nil
+}
+
+// DeliverClient is the common interface of the deliver streams of different types
+type DeliverClient interface {
+	Send(*common.Envelope) error
+	Recv() (*peer.DeliverResponse, error)
+	CloseSend() error
+}
+
+// CreateDeliverClient creates a deliver stream to the committer according to the deliver type.
+// It also returns the underlying connection so that the caller is able to close it before re-dialing
+func CreateDeliverClient() (DeliverClient, *grpc.ClientConn, error) {
+	conn, err := DialConnection(config.Committer)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	client, err := newDeliverClient(context.Background(), conn)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return client, conn, nil
+}
+
+// newDeliverClient creates a deliver stream on the connection according to the deliver type
+func newDeliverClient(ctx context.Context, conn *grpc.ClientConn) (DeliverClient, error) {
+	switch config.DeliverType {
+	case DeliverTypeBlock:
+		return peer.NewDeliverClient(conn).Deliver(ctx)
+	case DeliverTypePrivateData:
+		return peer.NewDeliverClient(conn).DeliverWithPrivateData(ctx)
+	default:
+		return peer.NewDeliverClient(conn).DeliverFiltered(ctx)
+	}
 }
 
 func DialConnection(node Node) (*grpc.ClientConn, error) {
@@ -92,16 +232,22 @@ func DialConnection(node Node) (*grpc.ClientConn, error) {
 		return nil, err
 	}
 
+	var tlsOptions []comm.TLSOption
+	if node.ServerNameOverride != "" {
+		tlsOptions = append(tlsOptions, comm.ServerNameOverride(node.ServerNameOverride))
+	}
+	if node.InsecureSkipVerify {
+		tlsOptions = append(tlsOptions, func(tlsConfig *tls.Config) {
+			tlsConfig.InsecureSkipVerify = true
+		})
+	}
+
+	var conn *grpc.ClientConn
 	for i := 1; i <= MAX_TRY; i++ {
-		conn, err := gRPCClient.NewConnection(
-			node.Address,
-			func(tlsConfig *tls.Config) {
-				tlsConfig.InsecureSkipVerify = true
-			},
-		)
+		conn, err = gRPCClient.NewConnection(node.Address, tlsOptions...)
 		if err == nil {
 			return conn, nil
 		}
 	}
-	return nil, errors.Wrapf(err, "failed to dial %s: %s", node.Address)
+	return nil, errors.Wrapf(err, "failed to dial %s", node.Address)
 }
@@ -1,66 +1,189 @@
 package infra
 
 import (
+	"crypto/tls"
 	"fmt"
 	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
 
-	"github.com/osdi23p228/fabric-protos-go/msp"
-	"github.com/gogo/protobuf/proto"
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v2"
 )
 
+const (
+	defaultIdleTime        = 30
+	defaultCommitStatusNum = 100
+
+	defaultEndorseTimeout       = 30000
+	defaultEndorseRetryInterval = 100
+
+	defaultConnectTimeout = 30000
+)
+
+// Modes of talking to the network
+const (
+	ModeDirect  = "direct"  // talk to endorsers, orderer and committer with the legacy protocols
+	ModeGateway = "gateway" // talk to the gateway service of a peer (Fabric v2.4+)
+)
+
+// Compressions of gRPC calls
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+)
+
+// Types of the deliver service used by the observer
+const (
+	DeliverTypeFiltered    = "filtered"    // filtered blocks, i.e. only txids and validation codes
+	DeliverTypeBlock       = "block"       // full blocks with payloads and metadata
+	DeliverTypePrivateData = "privateData" // full blocks along with private data
+)
+
 var (
 	itemNotProvidedError = errors.New("No such item")
 )
 
 type Node struct {
-	Address       string `yaml:"address"`
-	TLSCACert     string `yaml:"tlsCACert"`
-	TLSCAKey      string `yaml:"tlsCAKey"`
-	TLSCARoot     string `yaml:"tlsCARoot"`
-	TLSCACertByte []byte
-	TLSCAKeyByte  []byte
-	TLSCARootByte []byte
+	Address            string      `yaml:"address"`
+	MSPID              string      `yaml:"mspid"` // the MSP the node belongs, required by the endorsement policy
+	TLSCACert          string      `yaml:"tlsCACert"`
+	TLSCACerts         []string    `yaml:"tlsCACerts"`         // additional root CAs to verify the node's TLS certificate
+	TLSClientCert      string      `yaml:"tlsClientCert"`      // client certificate for mutual TLS, overrides the global one
+	TLSClientKey       string      `yaml:"tlsClientKey"`       // client private key for mutual TLS, overrides the global one
+	TLSCAKey           string      `yaml:"tlsCAKey"`           // deprecated, client private key matching tlsCACert, use tlsClientKey instead
+	TLSCARoot          string      `yaml:"tlsCARoot"`          // deprecated, enables mutual TLS with tlsCACert and tlsCAKey, use tlsClientCert instead
+	ServerNameOverride string      `yaml:"serverNameOverride"` // host name to verify the node's TLS certificate against, instead of the one in the address
+	InsecureSkipVerify bool        `yaml:"insecureSkipVerify"` // if true, do NOT verify the node's TLS certificate
+	GRPC               GRPCOptions `yaml:"grpc"`               // overrides the global gRPC options
+	TLSCACertByte      []byte
+	TLSCACertsByte     [][]byte
+	TLSClientCertByte  []byte
+	TLSClientKeyByte   []byte
+}
+
+// GRPCOptions tunes the gRPC transport to a node, where zero values fall back to
+// the global options, and then to the defaults
+type GRPCOptions struct {
+	ConnectTimeout        int    `yaml:"connectTimeout"`        // timeout of establishing a connection in milliseconds, 30000 by default
+	KeepaliveInterval     int    `yaml:"keepaliveInterval"`     // interval of pinging the server without activity in seconds, at least and by default 10
+	KeepaliveTimeout      int    `yaml:"keepaliveTimeout"`      // timeout of waiting for a ping ack in seconds, 20 by default
+	MaxRecvMsgSize        int    `yaml:"maxRecvMsgSize"`        // maximum size of a received message in bytes
+	MaxSendMsgSize        int    `yaml:"maxSendMsgSize"`        // maximum size of a sent message in bytes
+	Compression           string `yaml:"compression"`           // compression of all calls ['none', 'gzip']
+	InitialWindowSize     int32  `yaml:"initialWindowSize"`     // initial window size of a stream in bytes
+	InitialConnWindowSize int32  `yaml:"initialConnWindowSize"` // initial window size of a connection in bytes
 }
 
 type Config struct {
+	Mode string `yaml:"mode"` // mode of talking to the network ['direct', 'gateway']
+
 	// Network
 	Endorsers []Node `yaml:"endorsers"` // peers
 	Committer Node   `yaml:"committer"` // the peer chosen to observe blocks from
 	Orderer   Node   `yaml:"orderer"`   // orderer
 	Channel   string `yaml:"channel"`   // name of the channel to be operated on
 
+	// Fabric SDK connection profile (YAML or JSON). The nodes, channel and client's MSP ID
+	// not provided above are resolved from it, with relative paths against the profile's folder
+	ConnectionProfile string `yaml:"connectionProfile"`
+
+	// Service discovery, only used in 'direct' mode where it replaces endorsers and orderer
+	Discovery DiscoveryConfig `yaml:"discovery"`
+	Layouts   [][]string      // discovered sets of organizations satisfying the endorsement policy
+
+	// Endorsement policy, e.g. "AND('Org1MSP.peer', OR('Org2MSP.peer', 'Org3MSP.peer'))"
+	// If provided, each transaction is only sent to a minimal set of endorsers satisfying it,
+	// otherwise it is sent to the discovered layouts if any, or to all endorsers
+	EndorsementPolicy string             `yaml:"endorsementPolicy"`
+	EndorserSelection string             `yaml:"endorserSelection"` // how to choose a satisfying set ['roundRobin', 'random']
+	Policy            *EndorsementPolicy // parsed endorsement policy
+
+	// Gateway, only used in 'gateway' mode where it replaces endorsers and orderer
+	Gateway         Node `yaml:"gateway"`         // the peer providing the gateway service
+	CommitStatus    bool `yaml:"commitStatus"`    // if true, detect commits by CommitStatus instead of the deliver service
+	CommitStatusNum int  `yaml:"commitStatusNum"` // number of concurrent CommitStatus requests
+
+	DeliverType  string `yaml:"deliverType"`  // deliver service to observe blocks from ['filtered', 'block', 'privateData']
+	ObserveEvent bool   `yaml:"observeEvent"` // if true, extract chaincode events and measure event latency
+	EventName    string `yaml:"eventName"`    // name of the chaincode event to wait for, empty means any event
+
 	// Chaincode
 	Chaincode string   `yaml:"chaincode"` // chaincode name
 	Version   string   `yaml:"version"`   // chaincode version
-	Args      []string `yaml:"args"`      // chaincode arguments
+	Args      []string `yaml:"args"`      // chaincode arguments, i.e. the only operation of the 'template' tx type if no operation is provided
 
 	// Client identity
 	MSPID      string  `yaml:"mspid"`      // the MSP the client belongs
 	PrivateKey string  `yaml:"privateKey"` // client's private key
 	SignCert   string  `yaml:"signCert"`   // client's certificate
-	Identity   *Crypto // client's identity
+	Identity   *Crypto // client's identity, used for observing blocks and querying the network
+
+	// Alternatives to the private key and certificate files of the client
+	IdentityType   string `yaml:"identityType"`   // type of the client ['x509', 'idemix'], 'x509' by default
+	MSPDir         string `yaml:"mspDir"`         // MSP folder containing 'keystore' and 'signcerts'
+	Wallet         string `yaml:"wallet"`         // Fabric SDK file-system wallet folder
+	WalletLabel    string `yaml:"walletLabel"`    // label of the client in the wallet
+	KeyPasswordEnv string `yaml:"keyPasswordEnv"` // environment variable holding the password of an encrypted private key
+
+	Signer string       `yaml:"signer"` // backend holding the private key of the client ['sw', 'pkcs11'], 'sw' by default
+	PKCS11 PKCS11Config `yaml:"pkcs11"` // only used by the 'pkcs11' signer
+
+	// Identities submitting transactions, possibly from different MSPs.
+	// If not provided, the client's identity submits all transactions
+	Identities         []IdentityConfig  `yaml:"identities"`
+	IdentityAssignment string            `yaml:"identityAssignment"` // how to assign transactions to identities ['roundRobin', 'perConnection', 'rule']
+	IdentityRules      []IdentityRule    `yaml:"identityRules"`      // only used in 'rule' assignment
+	ClientIdentities   []*ClientIdentity // loaded identities submitting transactions
 
 	End2End bool `yaml:"e2e"` // running mode
 
+	// If true, generate, sign and assemble transactions with fabricated endorsements
+	// to measure the client-side cost, without talking to the network
+	DryRun       bool `yaml:"dryRun"`
+	DryRunSample int  `yaml:"dryRunSample"` // number of assembled envelopes dumped in dry run
+
 	Rate  int `yaml:"rate"`  // average speed of transaction generation
 	Burst int `yaml:"burst"` // maximum speed of transaction generation
 
 	TxNum           int     `yaml:"txNum"`           // number of transactions
-	TxTime          int     `yaml:"txTime"`          // maximum execution time
-	TxType          string  `yaml:"txType"`          // transaction type ['put', 'conflict']
+	TxTime          int     `yaml:"txTime"`          // maximum execution time in seconds, 0 means unlimited
+	IdleTime        int     `yaml:"idleTime"`        // maximum time in seconds to wait for the next block
+	TxType          string  `yaml:"txType"`          // transaction type, i.e. a registered workload, ['put', 'conflict', 'template'] built in, 'template' by default
 	TxIDStart       int     `yaml:"txIDStart"`       // the start of TX ID
 	Session         string  `yaml:"session"`         // session name
 	HotAccountRatio float64 `yaml:"hotAccountRatio"` // percentage of hot accounts
 	ConflictRatio   float64 `yaml:"conflictRatio"`   // Percentage of conflict
 
+	// Weighted operations of the 'template' tx type, along with the lists their templates pick values from
+	Operations []OperationConfig     `yaml:"operations"`
+	Lists      map[string]ListConfig `yaml:"lists"`
+
+	workload Workload // initialized workload of the transaction type, generating the transactions of the run
+
+	// Faults injected at scheduled times during the run, reported along with how the network reacted
+	Faults []FaultConfig `yaml:"faults"`
+
+	GRPC GRPCOptions `yaml:"grpc"` // gRPC options of all nodes
+
+	// Client TLS identity for mutual TLS with all nodes, unless a node has its own
+	TLSClientCert     string `yaml:"tlsClientCert"`
+	TLSClientKey      string `yaml:"tlsClientKey"`
+	TLSClientCertByte []byte
+	TLSClientKeyByte  []byte
+
 	ConnNum          int `yaml:"connNum"`          // number of connection
 	ClientPerConnNum int `yaml:"clientPerConnNum"` // number of client per connection
 	IntegratorNum    int `yaml:"integratorNum"`    // number of integrator
 	BroadcasterNum   int `yaml:"broadcasterNum"`   // number of orderer client
 	EndorserNum      int // number of endorsers
 
+	EndorseTimeout       int `yaml:"endorseTimeout"`       // deadline of each endorsement request in milliseconds
+	EndorseRetry         int `yaml:"endorseRetry"`         // maximum retries of an endorsement request failing with a transient error
+	EndorseRetryInterval int `yaml:"endorseRetryInterval"` // initial interval between retries in milliseconds, doubled after each retry
+	HedgeDelay           int `yaml:"hedgeDelay"`           // if positive, also send the proposal to another endorser of the same organization after the delay in milliseconds
+
 	// If true, let the protoutil generate txid automatically
 	// If false, encode the txid by us
 	// WARNING: Must modify the code in core/endorser/msgvalidation.go:Validate() and
@@ -74,107 +197,503 @@ type Config struct {
 	ReportPath string `yaml:"reportPath"` // path of the report file
 
 	Seed int `yaml:"seed"` // random seed
+
+	effective []byte // configuration file with the overrides applied
+}
+
+// ConfigErrors collects all problems found in a configuration file
+type ConfigErrors []error
+
+func (e ConfigErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("%d problem(s) found in config:\n\t%s", len(e), strings.Join(msgs, "\n\t"))
+}
+
+// add appends the error, flattening ConfigErrors, and ignores nil
+func (e *ConfigErrors) add(err error) {
+	switch err := err.(type) {
+	case nil:
+	case ConfigErrors:
+		*e = append(*e, err...)
+	default:
+		*e = append(*e, err)
+	}
 }
 
-func (c *Config) mustLoadRawConfigFromFile(filename string) {
+func (e *ConfigErrors) addf(format string, args ...interface{}) {
+	e.add(errors.Errorf(format, args...))
+}
+
+// err returns nil if there is no problem, so that the result is comparable to nil
+func (e ConfigErrors) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (c *Config) loadRawConfigFromFile(filename string, overrides []Override) error {
 	raw, err := ioutil.ReadFile(filename)
 	if err != nil {
-		logger.Panicf("Fail to load %s: %v", filename, err)
+		return errors.Wrapf(err, "fail to load %s", filename)
+	}
+
+	raw, err = applyOverrides(raw, overrides)
+	if err != nil {
+		return errors.Wrapf(err, "fail to apply overrides to %s", filename)
 	}
+	c.effective = raw
 
 	err = yaml.Unmarshal(raw, c)
 	if err != nil {
-		logger.Panicf("Fail to unmarshal %s: %v", filename, err)
+		return errors.Wrapf(err, "fail to unmarshal %s", filename)
 	}
+	return nil
 }
 
-func (c *Config) mustLoadEndorserConfig() {
-	for i := range c.Endorsers {
-		c.Endorsers[i].mustLoadConfig()
+func (c *Config) loadEndorserConfig() error {
+	var errs ConfigErrors
+	if c.Mode == ModeGateway {
+		// The gateway collects endorsements on behalf of the client
+		errs.add(c.Gateway.loadConfig())
+		c.Endorsers = []Node{c.Gateway}
+	} else {
+		for i := range c.Endorsers {
+			errs.add(c.Endorsers[i].loadConfig())
+		}
+	}
+	c.EndorserNum = len(c.Endorsers)
+	return errs.err()
+}
+
+func (c *Config) loadEndorsementPolicy() error {
+	// The gateway takes care of the endorsement policy by itself
+	if c.Mode == ModeGateway {
+		return nil
+	}
+
+	var policy *EndorsementPolicy
+	var err error
+	switch {
+	case c.EndorsementPolicy != "":
+		policy, err = NewEndorsementPolicy(c.EndorsementPolicy, c.Endorsers, c.EndorserSelection)
+	case len(c.Layouts) > 0:
+		policy, err = NewEndorsementPolicyFromLayouts(c.Layouts, c.Endorsers, c.EndorserSelection)
+	default:
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "fail to load endorsement policy")
+	}
+	c.Policy = policy
+	return nil
+}
+
+// discover replaces the endorsers and the orderer with the ones found by the discovery service,
+// and observes blocks from the discovery peer unless a committer is provided
+func (c *Config) discover() error {
+	if !c.Discovery.Enabled || c.Mode == ModeGateway {
+		return nil
+	}
+
+	result, err := Discover(c.Discovery.Peer, c.Channel, c.Chaincode, c.Identity)
+	if err != nil {
+		return errors.Wrap(err, "fail to discover the network")
 	}
+
+	c.Endorsers = result.Endorsers
 	c.EndorserNum = len(c.Endorsers)
+	c.Orderer = result.Orderer
+	for i := range c.Endorsers {
+		c.inheritNodeDefaults(&c.Endorsers[i])
+	}
+	c.inheritNodeDefaults(&c.Orderer)
+	c.Layouts = result.Layouts
+	if c.Committer.Address == "" {
+		c.Committer = c.Discovery.Peer
+	}
+
+	for _, endorser := range c.Endorsers {
+		fmt.Printf("Discovered endorser %s of %s\n", endorser.Address, endorser.MSPID)
+	}
+	fmt.Printf("Discovered orderer %s of %s\n", c.Orderer.Address, c.Orderer.MSPID)
+	return nil
+}
+
+func (c *Config) loadDiscoveryConfig() error {
+	return c.Discovery.Peer.loadConfig()
+}
+
+// loadNodeDefaults loads the global client TLS identity, and lets every node inherit it
+// along with the global gRPC options
+func (c *Config) loadNodeDefaults() error {
+	if c.GRPC.ConnectTimeout == 0 {
+		c.GRPC.ConnectTimeout = defaultConnectTimeout
+	}
+
+	certByte, keyByte, err := loadTLSClientKeyPair(c.TLSClientCert, c.TLSClientKey)
+	if err != nil {
+		return errors.Wrap(err, "fail to load global TLS client identity")
+	}
+	c.TLSClientCertByte = certByte
+	c.TLSClientKeyByte = keyByte
+
+	for i := range c.Endorsers {
+		c.inheritNodeDefaults(&c.Endorsers[i])
+	}
+	c.inheritNodeDefaults(&c.Committer)
+	c.inheritNodeDefaults(&c.Orderer)
+	c.inheritNodeDefaults(&c.Gateway)
+	c.inheritNodeDefaults(&c.Discovery.Peer)
+	return nil
+}
+
+func (c *Config) inheritNodeDefaults(n *Node) {
+	n.inheritGRPCOptions(c.GRPC)
+
+	if n.TLSClientCertByte == nil {
+		n.TLSClientCertByte = c.TLSClientCertByte
+		n.TLSClientKeyByte = c.TLSClientKeyByte
+	}
+}
+
+func (o GRPCOptions) validate() error {
+	var errs ConfigErrors
+	if o.ConnectTimeout < 0 || o.KeepaliveInterval < 0 || o.KeepaliveTimeout < 0 ||
+		o.MaxRecvMsgSize < 0 || o.MaxSendMsgSize < 0 || o.InitialWindowSize < 0 || o.InitialConnWindowSize < 0 {
+		errs.addf("gRPC options %+v contain a negative number", o)
+	}
+
+	switch o.Compression {
+	case "", CompressionNone, CompressionGzip:
+	default:
+		errs.addf("compression %s is not one of ['%s', '%s']", o.Compression, CompressionNone, CompressionGzip)
+	}
+	return errs.err()
+}
+
+// inheritGRPCOptions fills the unset gRPC options of the node with the global ones
+func (n *Node) inheritGRPCOptions(global GRPCOptions) {
+	o := &n.GRPC
+	if o.ConnectTimeout == 0 {
+		o.ConnectTimeout = global.ConnectTimeout
+	}
+	if o.KeepaliveInterval == 0 {
+		o.KeepaliveInterval = global.KeepaliveInterval
+	}
+	if o.KeepaliveTimeout == 0 {
+		o.KeepaliveTimeout = global.KeepaliveTimeout
+	}
+	if o.MaxRecvMsgSize == 0 {
+		o.MaxRecvMsgSize = global.MaxRecvMsgSize
+	}
+	if o.MaxSendMsgSize == 0 {
+		o.MaxSendMsgSize = global.MaxSendMsgSize
+	}
+	if o.Compression == "" {
+		o.Compression = global.Compression
+	}
+	if o.InitialWindowSize == 0 {
+		o.InitialWindowSize = global.InitialWindowSize
+	}
+	if o.InitialConnWindowSize == 0 {
+		o.InitialConnWindowSize = global.InitialConnWindowSize
+	}
 }
 
-func (c *Config) mustLoadCommiterConfig() {
-	c.Committer.mustLoadConfig()
+func (c *Config) loadCommiterConfig() error {
+	return c.Committer.loadConfig()
 }
 
-func (c *Config) mustLoadOrdererConfig() {
-	c.Orderer.mustLoadConfig()
+func (c *Config) loadOrdererConfig() error {
+	return c.Orderer.loadConfig()
 }
 
-func (c *Config) mustValid() {
+// validate checks the configuration and fills the defaults, returning all problems found
+func (c *Config) validate() error {
+	var errs ConfigErrors
+
+	switch c.Mode {
+	case "":
+		c.Mode = ModeDirect
+	case ModeDirect, ModeGateway:
+	default:
+		errs.addf("mode %s is not one of ['%s', '%s']", c.Mode, ModeDirect, ModeGateway)
+	}
+
+	// No node is dialed in dry run
+	if !c.DryRun {
+		errs.add(c.validateNodes())
+	}
+
+	if c.Channel == "" {
+		errs.addf("channel is not provided")
+	}
+	if c.Chaincode == "" {
+		errs.addf("chaincode is not provided")
+	}
+
 	if c.Rate < 0 {
-		logger.Panicf("Rate %f is not a zero (unlimited) or positive number\n", c.Rate)
+		errs.addf("rate %d is not a zero (unlimited) or positive number", c.Rate)
 	}
 
 	if c.Burst < 1 {
-		logger.Panicf("Burst %d is not greater than 1\n", c.Burst)
+		errs.addf("burst %d is not greater than 1", c.Burst)
+	} else if c.Rate > c.Burst {
+		fmt.Printf("Rate %d is bigger than burst %d, so let rate equal to burst\n", c.Rate, c.Burst)
+		c.Rate = c.Burst
 	}
 
-	if c.Rate > c.Burst {
-		logger.Printf("Rate %d is bigger than burst %d, so let rate equal to burst\n", c.Rate, c.Burst)
-		c.Rate = c.Burst
+	if c.TxNum < 1 {
+		errs.addf("tx number %d is not a positive number", c.TxNum)
 	}
 
-	if c.ConflictRatio < 0 || c.ConflictRatio > 1 {
-		logger.Panicf("Conflict ratio %f is not within the range of [0, 1]\n", c.ConflictRatio)
+	if c.TxTime < 0 {
+		errs.addf("tx time %d is not a zero (unlimited) or positive number", c.TxTime)
 	}
 
-	if c.HotAccountRatio < 0 || c.HotAccountRatio > 1 {
-		logger.Panicf("Hot account ratio %f is not within the range of [0, 1]\n", c.HotAccountRatio)
+	if c.IdleTime < 0 {
+		errs.addf("idle time %d is not a zero (default) or positive number", c.IdleTime)
+	} else if c.IdleTime == 0 {
+		c.IdleTime = defaultIdleTime
 	}
 
-	fmt.Printf("Conflict ratio %f\n", c.ConflictRatio)
-	fmt.Printf("Hot account ratio %f\n", c.HotAccountRatio)
+	if c.ConnNum < 1 {
+		errs.addf("connection number %d is not a positive number", c.ConnNum)
+	}
+	if c.ClientPerConnNum < 1 {
+		errs.addf("client per connection number %d is not a positive number", c.ClientPerConnNum)
+	}
+	if c.IntegratorNum < 1 {
+		errs.addf("integrator number %d is not a positive number", c.IntegratorNum)
+	}
+	if c.BroadcasterNum < 1 {
+		errs.addf("broadcaster number %d is not a positive number", c.BroadcasterNum)
+	}
+
+	if c.EndorseTimeout < 0 {
+		errs.addf("endorse timeout %d is not a zero (default) or positive number", c.EndorseTimeout)
+	} else if c.EndorseTimeout == 0 {
+		c.EndorseTimeout = defaultEndorseTimeout
+	}
+
+	if c.EndorseRetry < 0 {
+		errs.addf("endorse retry %d is not a zero (no retry) or positive number", c.EndorseRetry)
+	}
+
+	if c.EndorseRetryInterval < 0 {
+		errs.addf("endorse retry interval %d is not a zero (default) or positive number", c.EndorseRetryInterval)
+	} else if c.EndorseRetryInterval == 0 {
+		c.EndorseRetryInterval = defaultEndorseRetryInterval
+	}
+
+	if c.DryRunSample < 0 {
+		errs.addf("dry run sample %d is not a zero (no dump) or positive number", c.DryRunSample)
+	}
+
+	if c.HedgeDelay < 0 {
+		errs.addf("hedge delay %d is not a zero (disabled) or positive number", c.HedgeDelay)
+	}
+
+	if c.Mode == ModeGateway {
+		if c.CommitStatusNum < 0 {
+			errs.addf("CommitStatus number %d is not a zero (default) or positive number", c.CommitStatusNum)
+		} else if c.CommitStatusNum == 0 {
+			c.CommitStatusNum = defaultCommitStatusNum
+		}
+	}
+
+	switch c.IdentityAssignment {
+	case "":
+		c.IdentityAssignment = AssignmentRoundRobin
+	case AssignmentRoundRobin, AssignmentPerConnection, AssignmentRule:
+	default:
+		errs.addf("identity assignment %s is not one of ['%s', '%s', '%s']", c.IdentityAssignment, AssignmentRoundRobin, AssignmentPerConnection, AssignmentRule)
+	}
+
+	switch c.EndorserSelection {
+	case "":
+		c.EndorserSelection = SelectionRoundRobin
+	case SelectionRoundRobin, SelectionRandom:
+	default:
+		errs.addf("endorser selection %s is not one of ['%s', '%s']", c.EndorserSelection, SelectionRoundRobin, SelectionRandom)
+	}
+
+	switch c.DeliverType {
+	case "":
+		c.DeliverType = DeliverTypeFiltered
+	case DeliverTypeFiltered, DeliverTypeBlock, DeliverTypePrivateData:
+	default:
+		errs.addf("deliver type %s is not one of ['%s', '%s', '%s']", c.DeliverType, DeliverTypeFiltered, DeliverTypeBlock, DeliverTypePrivateData)
+	}
+
+	errs.add(c.validateWorkload())
+	errs.add(c.validateFaults())
+
+	return errs.err()
 }
 
-func LoadConfigFromFile(filename string) (*Config, error) {
-	c := &Config{}
+// validateNodes checks that the nodes required by the mode are provided with valid addresses
+func (c *Config) validateNodes() error {
+	var errs ConfigErrors
 
-	c.mustLoadRawConfigFromFile(filename)
-	c.mustLoadEndorserConfig()
-	c.mustLoadCommiterConfig()
-	c.mustLoadOrdererConfig()
-	c.mustLoadClientIdentity()
+	type roleNode struct {
+		role string
+		node *Node
+	}
+	var nodes []roleNode
+
+	switch {
+	case c.Mode == ModeGateway:
+		nodes = append(nodes, roleNode{"gateway", &c.Gateway})
+		if !c.CommitStatus {
+			nodes = append(nodes, roleNode{"committer", &c.Committer})
+		}
+	case c.Discovery.Enabled:
+		// The endorsers, orderer and committer are taken from the discovery service
+		nodes = append(nodes, roleNode{"discovery peer", &c.Discovery.Peer})
+		for i := range c.Endorsers {
+			nodes = append(nodes, roleNode{fmt.Sprintf("endorser %d", i), &c.Endorsers[i]})
+		}
+	default:
+		if len(c.Endorsers) == 0 {
+			errs.addf("no endorser is provided")
+		}
+		for i := range c.Endorsers {
+			nodes = append(nodes, roleNode{fmt.Sprintf("endorser %d", i), &c.Endorsers[i]})
+		}
+		nodes = append(nodes, roleNode{"committer", &c.Committer}, roleNode{"orderer", &c.Orderer})
+	}
 
-	c.mustValid()
+	errs.add(c.GRPC.validate())
+	for _, n := range nodes {
+		if err := validateAddress(n.node.Address); err != nil {
+			errs.add(errors.Wrapf(err, "%s", n.role))
+		}
+		if err := n.node.GRPC.validate(); err != nil {
+			errs.add(errors.Wrapf(err, "%s %s", n.role, n.node.Address))
+		}
+	}
 
-	return c, nil
+	return errs.err()
 }
 
-// mustLoadClientIdentity loads the client specified in the configuration file
-func (c *Config) mustLoadClientIdentity() {
-	cc := CryptoConfig{
-		MSPID:    c.MSPID,
-		PrivKey:  c.PrivateKey,
-		SignCert: c.SignCert,
+// validateAddress checks that the address is in the form of "host:port"
+func validateAddress(address string) error {
+	if address == "" {
+		return errors.New("address is not provided")
 	}
 
-	privateKey, err := GetPrivateKey(cc.PrivKey)
+	_, port, err := net.SplitHostPort(address)
 	if err != nil {
-		logger.Fatalf("Fail to load private key: %v", err)
+		return errors.Wrapf(err, "address %s is not in the form of 'host:port'", address)
 	}
+	if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+		return errors.Errorf("port of address %s is not within the range of [1, 65535]", address)
+	}
+	return nil
+}
 
-	cert, certBytes, err := GetCertificate(cc.SignCert)
-	if err != nil {
-		logger.Fatalf("Fail to load certificate: %v", err)
+// validateWorkload checks the ratios, and initializes the workload of the transaction type,
+// which checks whatever it needs, e.g. conflicting transactions need accounts split into non-empty hot and cold ones
+func (c *Config) validateWorkload() error {
+	var errs ConfigErrors
+
+	if c.ConflictRatio < 0 || c.ConflictRatio > 1 {
+		errs.addf("conflict ratio %f is not within the range of [0, 1]", c.ConflictRatio)
 	}
 
-	id := &msp.SerializedIdentity{
-		Mspid:   cc.MSPID,
-		IdBytes: certBytes,
+	if c.HotAccountRatio < 0 || c.HotAccountRatio > 1 {
+		errs.addf("hot account ratio %f is not within the range of [0, 1]", c.HotAccountRatio)
 	}
-	name, err := proto.Marshal(id)
-	if err != nil {
-		logger.Fatalf("Fail to get msp id: %v", err)
+
+	if c.TxType == "" {
+		c.TxType = TxTypeTemplate
+	}
+	newWorkload, ok := workloads[c.TxType]
+	if !ok {
+		errs.addf("tx type %s is not one of ['%s']", c.TxType, strings.Join(registeredWorkloads(), "', '"))
+		return errs.err()
+	}
+
+	// Ratios out of range would break the workload
+	if len(errs) == 0 {
+		c.workload = newWorkload()
+		errs.add(c.workload.Init(c))
+	}
+
+	return errs.err()
+}
+
+// LoadConfigFromFile loads the configuration with the overrides applied in order, and validates it.
+// All problems found are returned together as ConfigErrors
+func LoadConfigFromFile(filename string, overrides ...Override) (*Config, error) {
+	c := &Config{}
+
+	if err := c.loadRawConfigFromFile(filename, overrides); err != nil {
+		return nil, err
+	}
+
+	var errs ConfigErrors
+	errs.add(c.loadConnectionProfile())
+	errs.add(c.loadEndorserConfig())
+	errs.add(c.loadCommiterConfig())
+	errs.add(c.loadOrdererConfig())
+	errs.add(c.loadDiscoveryConfig())
+	errs.add(c.loadClientIdentity())
+	errs.add(c.loadNodeDefaults())
+
+	// Discovery queries the network with the loaded identity and nodes
+	if len(errs) == 0 && !c.DryRun {
+		errs.add(c.discover())
+	}
+
+	errs.add(c.validate())
+
+	// The endorsement policy is built upon valid endorsers
+	if len(errs) == 0 {
+		errs.add(c.loadEndorsementPolicy())
 	}
 
-	c.Identity = &Crypto{
-		Creator:  name,
-		PrivKey:  privateKey,
-		SignCert: cert,
+	if len(errs) > 0 {
+		return nil, errs
 	}
+
+	fmt.Printf("Conflict ratio %f\n", c.ConflictRatio)
+	fmt.Printf("Hot account ratio %f\n", c.HotAccountRatio)
+
+	return c, nil
+}
+
+// loadClientIdentity loads the client specified in the configuration file,
+// as well as the identities submitting transactions
+func (c *Config) loadClientIdentity() error {
+	ic := IdentityConfig{
+		Name:           defaultIdentityName,
+		Type:           c.IdentityType,
+		MSPID:          c.MSPID,
+		PrivateKey:     c.PrivateKey,
+		SignCert:       c.SignCert,
+		MSPDir:         c.MSPDir,
+		Wallet:         c.Wallet,
+		WalletLabel:    c.WalletLabel,
+		KeyPasswordEnv: c.KeyPasswordEnv,
+		Signer:         c.Signer,
+		PKCS11:         c.PKCS11,
+	}
+
+	if ic.PrivateKey != "" || ic.SignCert != "" || ic.MSPDir != "" || ic.Wallet != "" || len(c.Identities) == 0 {
+		identity, err := ic.load()
+		if err != nil {
+			return errors.Wrap(err, "fail to load client identity")
+		}
+		c.Identity = identity
+	}
+
+	return c.loadIdentities()
 }
 
 func GetTLSCACerts(file string) ([]byte, error) {
@@ -190,24 +709,68 @@ func GetTLSCACerts(file string) ([]byte, error) {
 	return in, nil
 }
 
-// TODO
-func (n *Node) mustLoadConfig() {
+func (n *Node) loadConfig() error {
+	var errs ConfigErrors
+
 	certByte, err := GetTLSCACerts(n.TLSCACert)
 	if err != nil && err != itemNotProvidedError {
-		logger.Fatalf("Fail to load TLS CA Cert %s: %v", n.TLSCACert, err)
+		errs.add(errors.Wrapf(err, "fail to load TLS CA Cert of %s", n.Address))
 	}
 
-	keyByte, err := GetTLSCACerts(n.TLSCAKey)
-	if err != nil && err != itemNotProvidedError {
-		logger.Fatalf("Fail to load TLS CA Key %s: %v", n.TLSCAKey, err)
+	// Fall back to the deprecated fields as before, i.e. 'tlsCACert' as the client certificate
+	// and 'tlsCAKey' as the client private key once both 'tlsCAKey' and 'tlsCARoot' are provided
+	clientCert, clientKey := n.TLSClientCert, n.TLSClientKey
+	if clientCert == "" && clientKey == "" && n.TLSCAKey != "" && n.TLSCARoot != "" {
+		clientCert, clientKey = n.TLSCACert, n.TLSCAKey
 	}
 
-	rootByte, err := GetTLSCACerts(n.TLSCARoot)
-	if err != nil && err != itemNotProvidedError {
-		logger.Fatalf("Fail to load TLS CA Root %s: %v", n.TLSCARoot, err)
+	clientCertByte, clientKeyByte, err := loadTLSClientKeyPair(clientCert, clientKey)
+	if err != nil {
+		errs.add(errors.Wrapf(err, "fail to load TLS client identity of %s", n.Address))
+	}
+
+	var certsByte [][]byte
+	for _, cert := range n.TLSCACerts {
+		b, err := GetTLSCACerts(cert)
+		if err != nil {
+			errs.add(errors.Wrapf(err, "fail to load TLS CA Cert of %s", n.Address))
+		}
+		certsByte = append(certsByte, b)
+	}
+
+	// Keep the inline certificates, e.g. imported from a connection profile
+	if certByte != nil {
+		n.TLSCACertByte = certByte
+	}
+	n.TLSCACertsByte = certsByte
+	n.TLSClientCertByte = clientCertByte
+	n.TLSClientKeyByte = clientKeyByte
+	return errs.err()
+}
+
+// loadTLSClientKeyPair loads the client certificate and private key for mutual TLS,
+// and makes sure that they match. Both are nil if neither is provided
+func loadTLSClientKeyPair(certFile, keyFile string) ([]byte, []byte, error) {
+	if certFile == "" && keyFile == "" {
+		return nil, nil, nil
+	}
+	if certFile == "" || keyFile == "" {
+		return nil, nil, errors.New("both TLS client certificate and key are required")
+	}
+
+	certByte, err := ioutil.ReadFile(certFile)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "fail to load %s", certFile)
+	}
+
+	keyByte, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "fail to load %s", keyFile)
+	}
+
+	if _, err = tls.X509KeyPair(certByte, keyByte); err != nil {
+		return nil, nil, errors.Wrapf(err, "TLS client certificate %s does not match key %s", certFile, keyFile)
 	}
 
-	n.TLSCACertByte = certByte
-	n.TLSCAKeyByte = keyByte
-	n.TLSCARootByte = rootByte
+	return certByte, keyByte, nil
 }
@@ -2,27 +2,33 @@ package infra
 
 import (
 	"crypto/ecdsa"
-	"crypto/rand"
 	"crypto/sha256"
 	"crypto/x509"
-	"encoding/asn1"
 	"encoding/base64"
 	"encoding/pem"
 	"fmt"
 	"io/ioutil"
 	"math/big"
 
+	"github.com/gogo/protobuf/proto"
 	"github.com/osdi23p228/fabric-protos-go/common"
-	"github.com/osdi23p228/fabric/bccsp/utils"
+	"github.com/osdi23p228/fabric-protos-go/msp"
 	"github.com/osdi23p228/fabric/common/crypto"
 	"github.com/pkg/errors"
 )
 
 type CryptoConfig struct {
-	MSPID      string
-	PrivKey    string
-	SignCert   string
-	TLSCACerts []string
+	MSPID       string
+	PrivKey     string
+	SignCert    string
+	MSPDir      string // MSP folder containing 'keystore' and 'signcerts'
+	Wallet      string // Fabric SDK file-system wallet folder
+	WalletLabel string // label of the identity in the wallet
+	KeyPassword []byte // password of the encrypted private key
+	Type        string // type of the identity ['x509', 'idemix']
+	Signer      string // backend holding the private key ['sw', 'pkcs11']
+	PKCS11      PKCS11Config
+	TLSCACerts  []string
 }
 
 type ECDSASignature struct {
@@ -30,24 +36,73 @@ type ECDSASignature struct {
 }
 
 type Crypto struct {
+	MSPID    string
 	Creator  []byte
-	PrivKey  *ecdsa.PrivateKey
-	SignCert *x509.Certificate
+	PrivKey  *ecdsa.PrivateKey // only available with the 'sw' signer
+	SignCert *x509.Certificate // not available for Idemix identities
+	Signer   KeySigner
 }
 
-// Sign signs the digest of a byte array (typically an unsigned proposal)
-func (s *Crypto) Sign(message []byte) ([]byte, error) {
-	ri, si, err := ecdsa.Sign(rand.Reader, s.PrivKey, digest(message))
+// NewCrypto loads the private key and the certificate of an identity
+// from files, an MSP folder or a wallet
+func NewCrypto(cc CryptoConfig) (*Crypto, error) {
+	switch cc.Type {
+	case "", IdentityTypeX509:
+	case IdentityTypeIdemix:
+		return NewIdemixCrypto(cc.MSPDir, cc.MSPID)
+	default:
+		return nil, errors.Errorf("identity type %s is not one of ['%s', '%s']", cc.Type, IdentityTypeX509, IdentityTypeIdemix)
+	}
+
+	keyPEM, certPEM, mspID, err := loadCredentials(cc)
 	if err != nil {
 		return nil, err
 	}
 
-	si, err = utils.ToLowS(&s.PrivKey.PublicKey, si)
+	cert, err := ParseCertificate(certPEM)
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrap(err, "fail to load certificate")
+	}
+
+	var privateKey *ecdsa.PrivateKey
+	var signer KeySigner
+	switch cc.Signer {
+	case "", SignerSW:
+		privateKey, err = ParsePrivateKey(keyPEM, cc.KeyPassword)
+		if err != nil {
+			return nil, errors.Wrap(err, "fail to load private key")
+		}
+		signer = &swSigner{key: privateKey}
+	case SignerPKCS11:
+		signer, err = newPKCS11Signer(cc.PKCS11, cert)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.Errorf("signer %s is not one of ['%s', '%s']", cc.Signer, SignerSW, SignerPKCS11)
+	}
+
+	id := &msp.SerializedIdentity{
+		Mspid:   mspID,
+		IdBytes: certPEM,
+	}
+	name, err := proto.Marshal(id)
+	if err != nil {
+		return nil, errors.Wrap(err, "fail to get msp id")
 	}
 
-	return asn1.Marshal(ECDSASignature{ri, si})
+	return &Crypto{
+		MSPID:    mspID,
+		Creator:  name,
+		PrivKey:  privateKey,
+		SignCert: cert,
+		Signer:   signer,
+	}, nil
+}
+
+// Sign signs the digest of a byte array (typically an unsigned proposal)
+func (s *Crypto) Sign(message []byte) ([]byte, error) {
+	return s.Signer.Sign(message)
 }
 
 func (s *Crypto) Serialize() ([]byte, error) {
@@ -150,7 +205,12 @@ func GetPrivateKey(f string) (*ecdsa.PrivateKey, error) {
 		return nil, err
 	}
 
-	k, err := PEMtoPrivateKey(in, []byte{})
+	return ParsePrivateKey(in, nil)
+}
+
+// ParsePrivateKey parses a PEM-encoded ECDSA private key, which is decrypted by the password if encrypted
+func ParsePrivateKey(raw []byte, pwd []byte) (*ecdsa.PrivateKey, error) {
+	k, err := PEMtoPrivateKey(raw, pwd)
 	if err != nil {
 		return nil, err
 	}
@@ -169,8 +229,16 @@ func GetCertificate(f string) (*x509.Certificate, []byte, error) {
 		return nil, nil, err
 	}
 
-	block, _ := pem.Decode(in)
-
-	c, err := x509.ParseCertificate(block.Bytes)
+	c, err := ParseCertificate(in)
 	return c, in, err
 }
+
+// ParseCertificate parses a PEM-encoded certificate
+func ParseCertificate(raw []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, errors.New("no PEM block is found")
+	}
+
+	return x509.ParseCertificate(block.Bytes)
+}
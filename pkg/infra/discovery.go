@@ -0,0 +1,246 @@
+package infra
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/osdi23p228/fabric-protos-go/discovery"
+	"github.com/osdi23p228/fabric-protos-go/gossip"
+	"github.com/osdi23p228/fabric-protos-go/msp"
+	"github.com/osdi23p228/fabric/protoutil"
+	"github.com/pkg/errors"
+)
+
+const (
+	discoveryTimeout = 30 * time.Second
+)
+
+type DiscoveryConfig struct {
+	Enabled bool `yaml:"enabled"` // if true, build endorsers and orderer from the discovery service
+	Peer    Node `yaml:"peer"`    // the peer to query the discovery service of
+}
+
+// DiscoveryResult contains the network layout resolved by the discovery service
+type DiscoveryResult struct {
+	Endorsers []Node     // all endorsers of the chaincode
+	Orderer   Node       // the first orderer of the channel
+	Layouts   [][]string // minimal sets of organizations satisfying the endorsement policy
+}
+
+// Discover queries the discovery service of the peer for the channel config
+// and the endorsement descriptor of the chaincode
+func Discover(peerNode Node, channel, chaincode string, identity *Crypto) (*DiscoveryResult, error) {
+	conn, err := DialConnection(peerNode)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	request, err := createSignedDiscoveryRequest(channel, chaincode, identity)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), discoveryTimeout)
+	defer cancel()
+	response, err := discovery.NewDiscoveryClient(conn).Discover(ctx, request)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to query discovery service of %s", peerNode.Address)
+	}
+
+	if len(response.Results) != 2 {
+		return nil, errors.Errorf("expect 2 discovery results, got %d", len(response.Results))
+	}
+	for _, result := range response.Results {
+		if e := result.GetError(); e != nil {
+			return nil, errors.Errorf("discovery service returns error: %s", e.Content)
+		}
+	}
+
+	configResult := response.Results[0].GetConfigResult()
+	if configResult == nil {
+		return nil, errors.New("missing config result")
+	}
+	ccResult := response.Results[1].GetCcQueryRes()
+	if ccResult == nil || len(ccResult.Content) == 0 {
+		return nil, errors.New("missing chaincode query result")
+	}
+
+	result := &DiscoveryResult{}
+
+	result.Orderer, err = getDiscoveredOrderer(configResult)
+	if err != nil {
+		return nil, err
+	}
+
+	result.Endorsers, result.Layouts, err = getDiscoveredEndorsers(ccResult.Content[0], configResult.Msps)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func createSignedDiscoveryRequest(channel, chaincode string, identity *Crypto) (*discovery.SignedRequest, error) {
+	creator, err := identity.Serialize()
+	if err != nil {
+		return nil, err
+	}
+
+	request := &discovery.Request{
+		Authentication: &discovery.AuthInfo{
+			ClientIdentity: creator,
+		},
+		Queries: []*discovery.Query{
+			{
+				Channel: channel,
+				Query: &discovery.Query_ConfigQuery{
+					ConfigQuery: &discovery.ConfigQuery{},
+				},
+			},
+			{
+				Channel: channel,
+				Query: &discovery.Query_CcQuery{
+					CcQuery: &discovery.ChaincodeQuery{
+						Interests: []*discovery.ChaincodeInterest{
+							{Chaincodes: []*discovery.ChaincodeCall{{Name: chaincode}}},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	payload, err := proto.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := identity.Sign(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &discovery.SignedRequest{
+		Payload:   payload,
+		Signature: signature,
+	}, nil
+}
+
+// getTLSRootCerts concatenates the PEM-encoded TLS root and intermediate certificates of an MSP
+func getTLSRootCerts(mspConfig *msp.FabricMSPConfig) []byte {
+	if mspConfig == nil {
+		return nil
+	}
+
+	var certs []byte
+	for _, cert := range mspConfig.TlsRootCerts {
+		certs = append(certs, cert...)
+	}
+	for _, cert := range mspConfig.TlsIntermediateCerts {
+		certs = append(certs, cert...)
+	}
+	return certs
+}
+
+// getDiscoveredOrderer returns the first endpoint of the orderer organizations sorted by MSP ID
+func getDiscoveredOrderer(configResult *discovery.ConfigResult) (Node, error) {
+	var mspIDs []string
+	for mspID := range configResult.Orderers {
+		mspIDs = append(mspIDs, mspID)
+	}
+	sort.Strings(mspIDs)
+
+	for _, mspID := range mspIDs {
+		for _, endpoint := range configResult.Orderers[mspID].Endpoint {
+			return Node{
+				Address:       fmt.Sprintf("%s:%d", endpoint.Host, endpoint.Port),
+				MSPID:         mspID,
+				TLSCACertByte: getTLSRootCerts(configResult.Msps[mspID]),
+			}, nil
+		}
+	}
+
+	return Node{}, errors.New("no orderer is found")
+}
+
+// getDiscoveredEndorsers returns the endorsers in the descriptor and the organizations required by each layout
+func getDiscoveredEndorsers(descriptor *discovery.EndorsementDescriptor, msps map[string]*msp.FabricMSPConfig) ([]Node, [][]string, error) {
+	var groups []string
+	for group := range descriptor.EndorsersByGroups {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+
+	var endorsers []Node
+	groupOrgs := make(map[string]string)
+	seen := make(map[string]bool)
+	for _, group := range groups {
+		for _, peer := range descriptor.EndorsersByGroups[group].Peers {
+			endpoint, err := getPeerEndpoint(peer)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			identity, err := protoutil.UnmarshalSerializedIdentity(peer.Identity)
+			if err != nil {
+				return nil, nil, err
+			}
+			groupOrgs[group] = identity.Mspid
+
+			if seen[endpoint] {
+				continue
+			}
+			seen[endpoint] = true
+
+			endorsers = append(endorsers, Node{
+				Address:       endpoint,
+				MSPID:         identity.Mspid,
+				TLSCACertByte: getTLSRootCerts(msps[identity.Mspid]),
+			})
+		}
+	}
+
+	if len(endorsers) == 0 {
+		return nil, nil, errors.Errorf("no endorser is found for chaincode %s", descriptor.Chaincode)
+	}
+
+	var layouts [][]string
+	for _, layout := range descriptor.Layouts {
+		orgSet := make(map[string]bool)
+		for group := range layout.QuantitiesByGroup {
+			if org, ok := groupOrgs[group]; ok {
+				orgSet[org] = true
+			}
+		}
+
+		var orgs []string
+		for org := range orgSet {
+			orgs = append(orgs, org)
+		}
+		sort.Strings(orgs)
+		layouts = append(layouts, orgs)
+	}
+
+	return endorsers, layouts, nil
+}
+
+func getPeerEndpoint(peer *discovery.Peer) (string, error) {
+	if peer.MembershipInfo == nil {
+		return "", errors.New("missing membership info")
+	}
+
+	message := &gossip.GossipMessage{}
+	if err := proto.Unmarshal(peer.MembershipInfo.Payload, message); err != nil {
+		return "", errors.Wrap(err, "error unmarshaling GossipMessage")
+	}
+
+	endpoint := message.GetAliveMsg().GetMembership().GetEndpoint()
+	if endpoint == "" {
+		return "", errors.New("missing peer endpoint")
+	}
+	return endpoint, nil
+}
@@ -0,0 +1,266 @@
+package infra
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/osdi23p228/fabric-protos-go/common"
+	"github.com/osdi23p228/fabric-protos-go/ledger/rwset"
+	"github.com/osdi23p228/fabric-protos-go/ledger/rwset/kvrwset"
+	"github.com/osdi23p228/fabric-protos-go/peer"
+	"github.com/osdi23p228/fabric/protoutil"
+	"github.com/pkg/errors"
+)
+
+const (
+	dryRunSampleFilename = "DRYRUN_ENVELOPES.txt"
+	dryRunPollInterval   = 10 * time.Millisecond // interval of checking whether the aborted transactions complete the assembly
+)
+
+// DryRun measures the client-side cost of a benchmark without a network.
+// Transactions are generated, signed and assembled into envelopes as in End2End,
+// but the endorsements are fabricated locally and nothing is sent
+func DryRun() {
+	initChannels()
+	initTimeKeepers()
+	initMismatchKeepers()
+
+	printWG := &sync.WaitGroup{}
+	go WriteLogToFile(printWG)
+
+	// Generation, i.e. creating the chaincode arguments and proposals
+	startTime := time.Now()
+	initiator := NewInitiator(unsignedCh)
+	generationDuration := time.Since(startTime)
+
+	elements := make([]*Element, len(initiator.proposals))
+	for i := range initiator.proposals {
+		elements[i] = &Element{
+			Proposal: initiator.proposals[i],
+			Txid:     initiator.txids[i],
+			Identity: initiator.identities[i],
+		}
+	}
+
+	// Signing, in a single goroutine as the signer does
+	signer := NewSigner(unsignedCh, signedChs)
+	startTime = time.Now()
+	for _, e := range elements {
+		if err := signer.SignElement(e); err != nil {
+			logger.Fatalf("Fail to sign transaction %s: %v", e.Txid, err)
+		}
+	}
+	signingDuration := time.Since(startTime)
+
+	// Endorsement, fabricated and not measured
+	for _, e := range elements {
+		if err := fabricateResponses(e); err != nil {
+			logger.Fatalf("Fail to fabricate responses of transaction %s: %v", e.Txid, err)
+		}
+	}
+
+	// Assembly, through the integrators as in End2End
+	inCh := make(chan *Element, len(elements))
+	outCh := make(chan *Element, len(elements))
+	for _, e := range elements {
+		inCh <- e
+	}
+
+	startTime = time.Now()
+	NewIntegrators(inCh, outCh).StartAsync()
+	waitAssembled(outCh, len(elements))
+	assemblyDuration := time.Since(startTime)
+
+	reportCh <- fmt.Sprintf("Dry Run: no transaction is sent to the network")
+	reportCh <- fmt.Sprintf("ALL Transactions: %d", len(elements))
+	_, abort := Metric.Count()
+	reportCh <- fmt.Sprintf("ABORTED Transactions: %d", abort)
+	reportDryRunStage("Generation", len(elements), generationDuration)
+	reportDryRunStage("Signing", len(elements), signingDuration)
+	reportDryRunStage("Assembly", len(elements), assemblyDuration)
+	reportEffectiveConfig()
+
+	if config.DryRunSample > 0 {
+		if err := dumpEnvelopes(elements, config.DryRunSample); err != nil {
+			logger.Errorf("Fail to dump envelopes: %v", err)
+		}
+	}
+
+	close(doneCh)
+	printWG.Wait()
+}
+
+// waitAssembled waits until each of the n elements is either sent out by the integrators or aborted.
+// Aborted elements are not sent out, so the number of aborted transactions is checked periodically
+func waitAssembled(outCh chan *Element, n int) {
+	ticker := time.NewTicker(dryRunPollInterval)
+	defer ticker.Stop()
+
+	assembled := 0
+	for {
+		if _, abort := Metric.Count(); assembled+int(abort) >= n {
+			return
+		}
+		select {
+		case <-outCh:
+			assembled++
+		case <-ticker.C:
+		}
+	}
+}
+
+func reportDryRunStage(stage string, n int, duration time.Duration) {
+	tps := 0.0
+	if duration > 0 {
+		tps = float64(n) / duration.Seconds()
+	}
+	reportCh <- fmt.Sprintf("%s Duration: %.3fs", stage, duration.Seconds())
+	reportCh <- fmt.Sprintf("%s TPS: %.3f", stage, tps)
+}
+
+// fabricateResponses endorses the transaction locally on behalf of the endorsers it would be sent to,
+// writing the chaincode arguments to the state. The client signs as every endorser
+func fabricateResponses(e *Element) error {
+	endorserNum := config.EndorserNum
+	if config.Policy != nil {
+		endorserNum = len(config.Policy.SelectEndorsers())
+	}
+	if endorserNum == 0 {
+		endorserNum = 1
+	}
+
+	input, err := protoutil.UnmarshalChaincodeProposalPayload(e.Proposal.Payload)
+	if err != nil {
+		return err
+	}
+	spec := &peer.ChaincodeInvocationSpec{}
+	if err = proto.Unmarshal(input.Input, spec); err != nil {
+		return err
+	}
+
+	// Write the arguments to the key of the first argument after the function name
+	args := spec.GetChaincodeSpec().GetInput().GetArgs()
+	var key string
+	if len(args) > 1 {
+		key = string(args[1])
+	}
+	ccid := spec.GetChaincodeSpec().GetChaincodeId()
+	results, err := fabricateRWSet(ccid.GetName(), key, bytes.Join(args, []byte(" ")))
+	if err != nil {
+		return err
+	}
+
+	response := &peer.Response{Status: 200, Message: "OK"}
+	for i := 0; i < endorserNum; i++ {
+		r, err := protoutil.CreateProposalResponse(e.Proposal.Header, e.Proposal.Payload, response, results, nil, ccid, e.Identity.Crypto)
+		if err != nil {
+			return err
+		}
+		e.Responses = append(e.Responses, r)
+	}
+	e.Endorsed = true
+
+	if config.Mode == ModeGateway {
+		// The gateway prepares the envelope, which is left for the client to sign
+		envelope, err := CreateSignedTx(e.Identity.Crypto, e.Proposal, e.Responses)
+		if err != nil {
+			return err
+		}
+		envelope.Signature = nil
+		e.Envelope = envelope
+	}
+	return nil
+}
+
+func fabricateRWSet(namespace string, key string, value []byte) ([]byte, error) {
+	kvRWSet, err := proto.Marshal(&kvrwset.KVRWSet{
+		Writes: []*kvrwset.KVWrite{{Key: key, Value: value}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return proto.Marshal(&rwset.TxReadWriteSet{
+		DataModel: rwset.TxReadWriteSet_KV,
+		NsRwset:   []*rwset.NsReadWriteSet{{Namespace: namespace, Rwset: kvRWSet}},
+	})
+}
+
+// dumpEnvelopes writes a summary of the first n envelopes along with their base64 encoding,
+// which can be decoded by "configtxlator proto_decode --type common.Envelope"
+func dumpEnvelopes(elements []*Element, n int) error {
+	f, err := os.Create(dryRunSampleFilename)
+	if err != nil {
+		return errors.Wrapf(err, "fail to create %s", dryRunSampleFilename)
+	}
+	defer f.Close()
+
+	for i, e := range elements {
+		if i >= n {
+			break
+		}
+		if e.Envelope == nil {
+			continue
+		}
+
+		raw, err := proto.Marshal(e.Envelope)
+		if err != nil {
+			return err
+		}
+		summary, err := summarizeEnvelope(e)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(f, "Envelope %d %s %d bytes\n", i, e.Txid, len(raw))
+		fmt.Fprintf(f, "%s", summary)
+		fmt.Fprintf(f, "  base64: %s\n", base64.StdEncoding.EncodeToString(raw))
+	}
+	return nil
+}
+
+func summarizeEnvelope(e *Element) (string, error) {
+	payload, err := protoutil.UnmarshalPayload(e.Envelope.Payload)
+	if err != nil {
+		return "", err
+	}
+	channelHeader, err := protoutil.UnmarshalChannelHeader(payload.Header.ChannelHeader)
+	if err != nil {
+		return "", err
+	}
+	tx, err := protoutil.UnmarshalTransaction(payload.Data)
+	if err != nil {
+		return "", err
+	}
+	if len(tx.Actions) == 0 {
+		return "", errors.New("no action in transaction")
+	}
+	ccActionPayload, err := protoutil.UnmarshalChaincodeActionPayload(tx.Actions[0].Payload)
+	if err != nil {
+		return "", err
+	}
+
+	var chaincode string
+	var args []string
+	if input, err := protoutil.UnmarshalChaincodeProposalPayload(ccActionPayload.ChaincodeProposalPayload); err == nil {
+		spec := &peer.ChaincodeInvocationSpec{}
+		if err = proto.Unmarshal(input.Input, spec); err == nil {
+			chaincode = spec.GetChaincodeSpec().GetChaincodeId().GetName()
+			for _, arg := range spec.GetChaincodeSpec().GetInput().GetArgs() {
+				args = append(args, string(arg))
+			}
+		}
+	}
+
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "  channel: %s, type: %s, identity: %s\n", channelHeader.ChannelId, common.HeaderType(channelHeader.Type), e.Identity.Name)
+	fmt.Fprintf(b, "  chaincode: %s, args: %s\n", chaincode, strings.Join(args, " "))
+	fmt.Fprintf(b, "  endorsements: %d\n", len(ccActionPayload.GetAction().GetEndorsements()))
+	return b.String(), nil
+}
@@ -11,8 +11,11 @@ import (
 type Element struct {
 	Proposal       *peer.Proposal
 	SignedProposal *peer.SignedProposal
-	Responses      []*peer.ProposalResponse
+	Responses      []*peer.ProposalResponse // appended under the lock until endorsed, then only read by the integrator
+	Endorsed       bool                     // whether enough responses have been collected
+	Pending        int                      // number of endorsement requests not finished yet
 	lock           sync.Mutex
 	Envelope       *common.Envelope
 	Txid           string
+	Identity       *ClientIdentity // identity submitting the transaction
 }
@@ -0,0 +1,346 @@
+package infra
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/osdi23p228/fabric-protos-go/common"
+)
+
+// Types of the faults injected during a run
+const (
+	FaultDropProposal   = "dropProposal"   // proposals are dropped instead of being sent to the endorsers
+	FaultDelayBroadcast = "delayBroadcast" // envelopes are held for a delay before being broadcast
+	FaultReconnect      = "reconnect"      // connections to an endorser or the orderer are killed and re-dialed
+	FaultDuplicateTxid  = "duplicateTxid"  // envelopes are broadcast twice
+	FaultBadSignature   = "badSignature"   // envelopes are broadcast with corrupted signatures
+)
+
+// FaultConfig schedules a fault within a window of the run, starting from when the first proposal is sent
+type FaultConfig struct {
+	Type     string  `yaml:"type"`     // type of the fault ['dropProposal', 'delayBroadcast', 'reconnect', 'duplicateTxid', 'badSignature']
+	Start    int     `yaml:"start"`    // start of the window in seconds, when 'reconnect' kills the connections
+	Duration int     `yaml:"duration"` // length of the window in seconds, 0 means until the end of the run
+	Rate     float64 `yaml:"rate"`     // fraction of the transactions hit within the window, 1 by default
+	Delay    int     `yaml:"delay"`    // only used by 'delayBroadcast', delay of each hit envelope in milliseconds
+	Node     string  `yaml:"node"`     // address of the endorser or orderer, only hit the requests to it if provided. Required by 'reconnect'
+}
+
+// validateFaults checks the faults, whose nodes must be the endorsers or the orderer requests are sent to
+func (c *Config) validateFaults() error {
+	var errs ConfigErrors
+
+	addresses := map[string]bool{c.Orderer.Address: true}
+	for _, endorser := range c.Endorsers {
+		addresses[endorser.Address] = true
+	}
+
+	for i := range c.Faults {
+		fc := &c.Faults[i]
+
+		switch fc.Type {
+		case FaultDropProposal, FaultDelayBroadcast, FaultDuplicateTxid, FaultBadSignature:
+		case FaultReconnect:
+			if c.Mode == ModeGateway {
+				errs.addf("fault %d: '%s' is not supported in '%s' mode", i, FaultReconnect, ModeGateway)
+			}
+			if fc.Node == "" {
+				errs.addf("fault %d: node of '%s' is not provided", i, FaultReconnect)
+			}
+		default:
+			errs.addf("fault %d: type %s is not one of ['%s', '%s', '%s', '%s', '%s']", i, fc.Type,
+				FaultDropProposal, FaultDelayBroadcast, FaultReconnect, FaultDuplicateTxid, FaultBadSignature)
+		}
+
+		if fc.Start < 0 {
+			errs.addf("fault %d: start %d is not a zero or positive number", i, fc.Start)
+		}
+		if fc.Duration < 0 {
+			errs.addf("fault %d: duration %d is not a zero (until the end) or positive number", i, fc.Duration)
+		}
+
+		if fc.Rate < 0 || fc.Rate > 1 {
+			errs.addf("fault %d: rate %f is not within [0, 1]", i, fc.Rate)
+		} else if fc.Rate == 0 {
+			fc.Rate = 1
+		}
+
+		if fc.Type == FaultDelayBroadcast && fc.Delay < 1 {
+			errs.addf("fault %d: delay %d is not a positive number", i, fc.Delay)
+		}
+
+		if fc.Node != "" && !addresses[fc.Node] {
+			errs.addf("fault %d: node %s is not an address of the endorsers or the orderer", i, fc.Node)
+		}
+	}
+
+	return errs.err()
+}
+
+var (
+	faultKeepers FaultKeepers
+)
+
+// FaultKeepers injects the scheduled faults and records the transactions they hit,
+// along with how the network reacts to them
+type FaultKeepers struct {
+	faults       []*FaultKeeper
+	startTime    int64 // when the first proposal is sent in nanoseconds, 0 before that
+	lock         sync.Mutex
+	reactions    map[string][]string                      // responses of the network to the hit transactions by txid
+	reconnectors map[string][]func(fk *FaultKeeper) error // functions re-dialing a connection by node address
+}
+
+// FaultKeeper is a scheduled fault along with what it has hit
+type FaultKeeper struct {
+	FaultConfig
+	hit      map[string]bool // txids of the hit transactions
+	redialed int             // only used by 'reconnect', number of re-dialed connections
+	failed   int             // only used by 'reconnect', number of connections failing to be re-dialed
+}
+
+func initFaultKeepers() {
+	faultKeepers = FaultKeepers{
+		reactions:    make(map[string][]string),
+		reconnectors: make(map[string][]func(fk *FaultKeeper) error),
+	}
+	for _, fc := range config.Faults {
+		faultKeepers.faults = append(faultKeepers.faults, &FaultKeeper{
+			FaultConfig: fc,
+			hit:         make(map[string]bool),
+		})
+	}
+}
+
+// addReconnector registers a function which kills and re-dials a connection to the node
+// on behalf of the fault, which hits the transactions lost along with the connection
+func (fks *FaultKeepers) addReconnector(address string, reconnect func(fk *FaultKeeper) error) {
+	fks.lock.Lock()
+	defer fks.lock.Unlock()
+
+	fks.reconnectors[address] = append(fks.reconnectors[address], reconnect)
+}
+
+// start starts the windows of the faults from now on
+func (fks *FaultKeepers) start() {
+	atomic.StoreInt64(&fks.startTime, time.Now().UnixNano())
+
+	for _, fk := range fks.faults {
+		if fk.Type == FaultReconnect {
+			fk := fk
+			time.AfterFunc(time.Duration(fk.Start)*time.Second, func() {
+				fks.reconnect(fk)
+			})
+		}
+	}
+}
+
+// reconnect kills and re-dials all connections to the node of the fault
+func (fks *FaultKeepers) reconnect(fk *FaultKeeper) {
+	select {
+	case <-doneCh:
+		return
+	default:
+	}
+
+	fks.lock.Lock()
+	reconnectors := fks.reconnectors[fk.Node]
+	fks.lock.Unlock()
+
+	logger.Warnf("Inject fault: kill and re-dial %d connections to %s", len(reconnectors), fk.Node)
+	for _, reconnect := range reconnectors {
+		err := reconnect(fk)
+		if err != nil {
+			logger.Errorf("Fail to re-dial %s: %v", fk.Node, err)
+		}
+
+		fks.lock.Lock()
+		if err != nil {
+			fk.failed++
+		} else {
+			fk.redialed++
+		}
+		fks.lock.Unlock()
+	}
+}
+
+// inject returns the fault of the type hitting the transaction, whose request is being sent to the node,
+// or nil if no fault hits it. The transaction is recorded as hit by the returned fault
+func (fks *FaultKeepers) inject(faultType string, address string, txid string) *FaultKeeper {
+	startTime := atomic.LoadInt64(&fks.startTime)
+	if startTime == 0 {
+		return nil
+	}
+	elapsed := time.Duration(time.Now().UnixNano() - startTime)
+
+	for _, fk := range fks.faults {
+		if fk.Type != faultType || !fk.isActive(elapsed) || (fk.Node != "" && fk.Node != address) {
+			continue
+		}
+		if fk.Rate < 1 && rand.Float64() >= fk.Rate {
+			continue
+		}
+
+		fks.keepHit(fk, txid)
+		return fk
+	}
+	return nil
+}
+
+// keepHit records the transaction as hit by the fault
+func (fks *FaultKeepers) keepHit(fk *FaultKeeper, txid string) {
+	fks.lock.Lock()
+	defer fks.lock.Unlock()
+
+	fk.hit[txid] = true
+}
+
+// isActive returns true if the time elapsed since the start of the run is within the window
+func (fk *FaultKeeper) isActive(elapsed time.Duration) bool {
+	start := time.Duration(fk.Start) * time.Second
+	end := start + time.Duration(fk.Duration)*time.Second
+	return elapsed >= start && (fk.Duration == 0 || elapsed < end)
+}
+
+// keepReaction records a response of the network, i.e. a validation code or a rejection status,
+// to the transaction if it has been hit by a fault
+func (fks *FaultKeepers) keepReaction(txid string, reaction string) {
+	if len(fks.faults) == 0 {
+		return
+	}
+
+	fks.lock.Lock()
+	defer fks.lock.Unlock()
+
+	for _, fk := range fks.faults {
+		if fk.hit[txid] {
+			fks.reactions[txid] = append(fks.reactions[txid], reaction)
+			return
+		}
+	}
+}
+
+// corruptSignature returns a copy of the envelope whose signature no longer matches the payload
+func corruptSignature(envelope *common.Envelope) *common.Envelope {
+	signature := make([]byte, len(envelope.Signature))
+	copy(signature, envelope.Signature)
+	if len(signature) > 0 {
+		signature[len(signature)-1] ^= 0xff
+	}
+
+	return &common.Envelope{
+		Payload:   envelope.Payload,
+		Signature: signature,
+	}
+}
+
+// reportFaults sends the statistics of each fault to the report file: what happened to the hit transactions,
+// how the network responded to them, and the throughput of valid transactions within the window
+func reportFaults(endTime time.Time) {
+	if len(faultKeepers.faults) == 0 {
+		return
+	}
+
+	faultKeepers.lock.Lock()
+	defer faultKeepers.lock.Unlock()
+
+	startTime := atomic.LoadInt64(&faultKeepers.startTime)
+
+	reportCh <- fmt.Sprintf("fault          node                   window(s) redialed    hit   valid invalid aborted unobserved  window-tps reactions")
+	for _, fk := range faultKeepers.faults {
+		node := fk.Node
+		if node == "" {
+			node = "-"
+		}
+
+		windowStart := startTime + int64(fk.Start)*int64(time.Second)
+		windowEnd := endTime.UnixNano()
+		window := fmt.Sprintf("%d-", fk.Start)
+		if fk.Duration > 0 {
+			window = fmt.Sprintf("%d-%d", fk.Start, fk.Start+fk.Duration)
+			if end := windowStart + int64(fk.Duration)*int64(time.Second); end < windowEnd {
+				windowEnd = end
+			}
+		}
+
+		var valid, invalid, aborted, unobserved int
+		reactions := make(map[string]int)
+		for txid := range fk.hit {
+			tk := timeKeepers.transactions[txid2id[txid]]
+			switch {
+			case tk.AbortedTime != 0:
+				aborted++
+			case tk.ObservedTime != 0 && tk.Valid:
+				valid++
+			case tk.ObservedTime != 0:
+				invalid++
+			default:
+				unobserved++
+			}
+
+			for _, reaction := range faultKeepers.reactions[txid] {
+				reactions[reaction]++
+			}
+		}
+
+		// Only 'reconnect' kills connections, reported as the re-dialed ones out of the killed ones,
+		// while the transactions whose requests are lost along with the connections are hit by it
+		redialed := "-"
+		if fk.Type == FaultReconnect {
+			redialed = fmt.Sprintf("%d/%d", fk.redialed, fk.redialed+fk.failed)
+		}
+
+		reportCh <- fmt.Sprintf("%-14s %-22s %9s %8s %6d %7d %7d %7d %10d %11.3f %s",
+			fk.Type,
+			node,
+			window,
+			redialed,
+			len(fk.hit),
+			valid,
+			invalid,
+			aborted,
+			unobserved,
+			getWindowTPS(windowStart, windowEnd),
+			formatReactions(reactions),
+		)
+	}
+}
+
+// getWindowTPS returns the throughput of valid transactions observed within the window in nanoseconds
+func getWindowTPS(start int64, end int64) float64 {
+	if end <= start {
+		return 0
+	}
+
+	n := 0
+	for _, tk := range timeKeepers.transactions {
+		if tk.Valid && tk.ObservedTime >= start && tk.ObservedTime < end {
+			n++
+		}
+	}
+	return float64(n) * 1e9 / float64(end-start)
+}
+
+// formatReactions formats the counts of the reactions sorted by name, e.g. "DUPLICATE_TXID:10 VALID:10"
+func formatReactions(reactions map[string]int) string {
+	if len(reactions) == 0 {
+		return "-"
+	}
+
+	var names []string
+	for name := range reactions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var items []string
+	for _, name := range names {
+		items = append(items, fmt.Sprintf("%s:%d", name, reactions[name]))
+	}
+	return strings.Join(items, " ")
+}
@@ -0,0 +1,51 @@
+package infra
+
+import (
+	"github.com/osdi23p228/fabric/msp"
+	"github.com/pkg/errors"
+)
+
+// Types of client identities
+const (
+	IdentityTypeX509   = "x509"   // X.509 certificate and private key
+	IdentityTypeIdemix = "idemix" // Idemix anonymous credential
+)
+
+// NewIdemixCrypto loads an Idemix MSP from the folder generated by idemixgen, i.e. the issuer and
+// revocation public keys in 'msp' and the user's signer config in 'user', and returns its default
+// signing identity. Every signature is an Idemix proof produced with the pseudonym of the identity
+func NewIdemixCrypto(dir, mspID string) (*Crypto, error) {
+	if mspID == "" {
+		return nil, errors.New("MSP ID of the Idemix identity is not provided")
+	}
+
+	conf, err := msp.GetIdemixMspConfig(dir, mspID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to load Idemix MSP config from %s", dir)
+	}
+
+	idemixMSP, err := msp.New(&msp.IdemixNewOpts{NewBaseOpts: msp.NewBaseOpts{Version: msp.MSPv1_3}}, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "fail to create Idemix MSP")
+	}
+
+	if err = idemixMSP.Setup(conf); err != nil {
+		return nil, errors.Wrapf(err, "fail to set up Idemix MSP %s", mspID)
+	}
+
+	signingIdentity, err := idemixMSP.GetDefaultSigningIdentity()
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to get Idemix signing identity from %s", dir)
+	}
+
+	creator, err := signingIdentity.Serialize()
+	if err != nil {
+		return nil, errors.Wrap(err, "fail to serialize Idemix identity")
+	}
+
+	return &Crypto{
+		MSPID:   mspID,
+		Creator: creator,
+		Signer:  signingIdentity,
+	}, nil
+}
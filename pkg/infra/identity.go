@@ -0,0 +1,199 @@
+package infra
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// Strategies of assigning transactions to identities
+const (
+	AssignmentRoundRobin    = "roundRobin"    // the i-th transaction is submitted by the (i mod n)-th identity
+	AssignmentPerConnection = "perConnection" // transactions sent through the j-th connection are submitted by the (j mod n)-th identity
+	AssignmentRule          = "rule"          // transactions are submitted by the identity matching their chaincode function
+)
+
+const (
+	defaultIdentityName = "default"
+)
+
+// IdentityConfig locates the credentials of an identity in one of the following ways:
+// a wallet with a label, an MSP folder, or a private key file along with a certificate file.
+// An Idemix identity is always loaded from the folder generated by idemixgen
+type IdentityConfig struct {
+	Name           string `yaml:"name"`           // unique name of the identity, referred by the rules
+	Type           string `yaml:"type"`           // type of the identity ['x509', 'idemix'], 'x509' by default
+	MSPID          string `yaml:"mspid"`          // the MSP the identity belongs, optional for a wallet
+	PrivateKey     string `yaml:"privateKey"`     // identity's private key
+	SignCert       string `yaml:"signCert"`       // identity's certificate
+	MSPDir         string `yaml:"mspDir"`         // MSP folder containing 'keystore' and 'signcerts', or 'msp' and 'user' for Idemix
+	Wallet         string `yaml:"wallet"`         // Fabric SDK file-system wallet folder
+	WalletLabel    string `yaml:"walletLabel"`    // label of the identity in the wallet, the name by default
+	KeyPasswordEnv string `yaml:"keyPasswordEnv"` // environment variable holding the password of an encrypted private key
+
+	Signer string       `yaml:"signer"` // backend holding the private key ['sw', 'pkcs11'], 'sw' by default
+	PKCS11 PKCS11Config `yaml:"pkcs11"` // only used by the 'pkcs11' signer
+}
+
+type IdentityRule struct {
+	Function string `yaml:"function"` // chaincode function name, i.e. the first argument
+	Identity string `yaml:"identity"` // name of the identity submitting the matched transactions
+}
+
+// ClientIdentity is an identity submitting transactions
+type ClientIdentity struct {
+	Name string
+	*Crypto
+}
+
+// load loads the credentials of the identity
+func (ic IdentityConfig) load() (*Crypto, error) {
+	password, err := getSecretFromEnv(ic.KeyPasswordEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	pkcs11 := ic.PKCS11
+	if pkcs11.PinEnv != "" {
+		pin, err := getSecretFromEnv(pkcs11.PinEnv)
+		if err != nil {
+			return nil, err
+		}
+		pkcs11.Pin = string(pin)
+	}
+
+	label := ic.WalletLabel
+	if label == "" {
+		label = ic.Name
+	}
+
+	return NewCrypto(CryptoConfig{
+		Type:        ic.Type,
+		MSPID:       ic.MSPID,
+		PrivKey:     ic.PrivateKey,
+		SignCert:    ic.SignCert,
+		MSPDir:      ic.MSPDir,
+		Wallet:      ic.Wallet,
+		WalletLabel: label,
+		KeyPassword: password,
+		Signer:      ic.Signer,
+		PKCS11:      pkcs11,
+	})
+}
+
+// loadIdentities loads the identities submitting transactions,
+// falling back to the client's identity if none is provided
+func (c *Config) loadIdentities() error {
+	if len(c.Identities) == 0 {
+		c.ClientIdentities = []*ClientIdentity{{
+			Name:   defaultIdentityName,
+			Crypto: c.Identity,
+		}}
+		return nil
+	}
+
+	var errs ConfigErrors
+	names := make(map[string]bool)
+	for i, ic := range c.Identities {
+		if ic.Name == "" {
+			ic.Name = fmt.Sprintf("identity%d", i)
+		}
+		if names[ic.Name] {
+			errs.addf("identity name %s is duplicated", ic.Name)
+			continue
+		}
+		names[ic.Name] = true
+
+		crypto, err := ic.load()
+		if err != nil {
+			errs.add(errors.Wrapf(err, "fail to load identity %s", ic.Name))
+			continue
+		}
+
+		c.ClientIdentities = append(c.ClientIdentities, &ClientIdentity{
+			Name:   ic.Name,
+			Crypto: crypto,
+		})
+	}
+
+	for _, rule := range c.IdentityRules {
+		if !names[rule.Identity] {
+			errs.addf("identity %s of the rule for function %s is not found", rule.Identity, rule.Function)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	// Observe blocks with the first identity if the client's identity is not provided
+	if c.Identity == nil {
+		c.Identity = c.ClientIdentities[0].Crypto
+	}
+	return nil
+}
+
+// assignIdentity returns the index of the identity submitting the i-th transaction
+func assignIdentity(i int, function string) int {
+	n := len(config.ClientIdentities)
+
+	switch config.IdentityAssignment {
+	case AssignmentPerConnection:
+		connIndex := (i / config.ClientPerConnNum) % config.ConnNum
+		return connIndex % n
+	case AssignmentRule:
+		for _, rule := range config.IdentityRules {
+			if rule.Function != function {
+				continue
+			}
+			for j, identity := range config.ClientIdentities {
+				if identity.Name == rule.Identity {
+					return j
+				}
+			}
+		}
+		// Unmatched transactions are assigned in a round-robin way
+		return i % n
+	default:
+		return i % n
+	}
+}
+
+// reportIdentities sends the statistics of each identity to the report file
+func reportIdentities() {
+	if len(config.ClientIdentities) < 2 {
+		return
+	}
+
+	txNum := make([]int, len(config.ClientIdentities))
+	validNum := make([]int, len(config.ClientIdentities))
+	abortNum := make([]int, len(config.ClientIdentities))
+	totalLatency := make([]int64, len(config.ClientIdentities))
+	for id, tk := range timeKeepers.transactions {
+		txNum[tk.Identity]++
+		switch {
+		case tk.ObservedTime != 0 && tk.Valid:
+			validNum[tk.Identity]++
+			totalLatency[tk.Identity] += timeKeepers.totalLatency[id]
+		case tk.ObservedTime != 0 || tk.AbortedTime != 0:
+			abortNum[tk.Identity]++
+		}
+	}
+
+	reportCh <- fmt.Sprintf("identity             mspid                  txs   valid aborted commit-latency(s)")
+	for i, identity := range config.ClientIdentities {
+		latency := 0.0
+		if validNum[i] > 0 {
+			latency = float64(totalLatency[i]) / float64(validNum[i]) / 1e9
+		}
+
+		reportCh <- fmt.Sprintf("%-20s %-20s %5d %7d %7d %17.3f",
+			identity.Name,
+			identity.MSPID,
+			txNum[i],
+			validNum[i],
+			abortNum[i],
+			latency,
+		)
+	}
+}
@@ -7,35 +7,43 @@ import (
 )
 
 type Initiator struct {
-	proposals []*peer.Proposal
-	txids     []string
-	outCh     chan *Element
+	proposals  []*peer.Proposal
+	txids      []string
+	identities []*ClientIdentity
+	outCh      chan *Element
 }
 
 func NewInitiator(outCh chan *Element) *Initiator {
 	it := &Initiator{
-		proposals: make([]*peer.Proposal, config.TxNum),
-		txids:     make([]string, config.TxNum),
-		outCh:     outCh,
+		proposals:  make([]*peer.Proposal, config.TxNum),
+		txids:      make([]string, config.TxNum),
+		identities: make([]*ClientIdentity, config.TxNum),
+		outCh:      outCh,
 	}
 
 	// Create proposal and id for all generated transactions
-	ccArgsList := generateCCArgsList()
+	invocations := generateInvocations()
 	session := getSession()
 	for i := 0; i < config.TxNum; i++ {
-		ccArgs := ccArgsList[i]
+		invocation := invocations[i]
 
 		tempTXID := ""
 		if !config.CheckTxID {
 			tempTXID = generateCustomTXID(i, session)
 		}
 
+		identityIndex := assignIdentity(i, invocation.Function)
+		identity := config.ClientIdentities[identityIndex]
+
+		chaincode, version := invocation.chaincode()
 		proposal, txID, err := CreateProposal(
+			identity.Crypto,
 			tempTXID,
 			config.Channel,
-			config.Chaincode,
-			config.Version,
-			ccArgs,
+			chaincode,
+			version,
+			invocation.ccArgs(),
+			invocation.Transient,
 		)
 		if err != nil {
 			logger.Fatalf("Fail to create proposal %s: %v", txID, err)
@@ -44,6 +52,8 @@ func NewInitiator(outCh chan *Element) *Initiator {
 		txid2id[txID] = i
 		it.proposals[i] = proposal
 		it.txids[i] = txID
+		it.identities[i] = identity
+		timeKeepers.transactions[i].Identity = identityIndex
 	}
 
 	return it
@@ -64,7 +74,7 @@ func generateCustomTXID(i int, session string) string {
 // waiting for subsequent processing
 func (it *Initiator) StartSync() {
 	for i := 0; i < len(it.proposals); i++ {
-		it.outCh <- &Element{Proposal: it.proposals[i], Txid: it.txids[i]}
+		it.outCh <- &Element{Proposal: it.proposals[i], Txid: it.txids[i], Identity: it.identities[i]}
 	}
 
 	it.End()
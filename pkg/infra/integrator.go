@@ -37,7 +37,9 @@ func (it *Integrator) Start() {
 			envelope, err := it.Integrate(element)
 			if err != nil {
 				// Abort directly because of the different endorsement
+				mismatchKeepers.keepMismatch(element)
 				Metric.AddAbort()
+				timeKeepers.keepAbortedTime(element.Txid)
 				continue
 			}
 			it.outCh <- envelope
@@ -49,7 +51,15 @@ func (it *Integrator) Start() {
 
 // integrate extracts responses and generates an envelope
 func (it *Integrator) Integrate(e *Element) (*Element, error) {
-	envelope, err := CreateSignedTx(e.Proposal, e.Responses)
+	if config.Mode == ModeGateway {
+		// The gateway has prepared the envelope, which only needs the client's signature
+		if err := SignPreparedTransaction(e.Identity.Crypto, e.Envelope); err != nil {
+			return nil, err
+		}
+		return e, nil
+	}
+
+	envelope, err := CreateSignedTx(e.Identity.Crypto, e.Proposal, e.Responses)
 	if err != nil {
 		return nil, err
 	}
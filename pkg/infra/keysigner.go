@@ -0,0 +1,46 @@
+package infra
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/asn1"
+
+	"github.com/osdi23p228/fabric/bccsp/utils"
+)
+
+// Backends holding the private key of an identity
+const (
+	SignerSW     = "sw"     // in-memory ECDSA key loaded from a PEM file
+	SignerPKCS11 = "pkcs11" // key in an HSM accessed through PKCS#11, requires building with '-tags pkcs11'
+)
+
+// KeySigner signs messages with the private key of an identity, wherever the key resides
+type KeySigner interface {
+	Sign(message []byte) ([]byte, error)
+}
+
+type PKCS11Config struct {
+	Library string `yaml:"library"` // path of the PKCS#11 library, e.g. /usr/lib/softhsm/libsofthsm2.so
+	Label   string `yaml:"label"`   // label of the token holding the private key
+	Pin     string `yaml:"pin"`     // user PIN of the token
+	PinEnv  string `yaml:"pinEnv"`  // environment variable holding the user PIN, preferred over pin
+}
+
+// swSigner signs with an in-memory ECDSA private key
+type swSigner struct {
+	key *ecdsa.PrivateKey
+}
+
+func (s *swSigner) Sign(message []byte) ([]byte, error) {
+	ri, si, err := ecdsa.Sign(rand.Reader, s.key, digest(message))
+	if err != nil {
+		return nil, err
+	}
+
+	si, err = utils.ToLowS(&s.key.PublicKey, si)
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(ECDSASignature{ri, si})
+}
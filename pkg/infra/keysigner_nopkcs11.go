@@ -0,0 +1,13 @@
+//go:build !pkcs11
+
+package infra
+
+import (
+	"crypto/x509"
+
+	"github.com/pkg/errors"
+)
+
+func newPKCS11Signer(conf PKCS11Config, cert *x509.Certificate) (KeySigner, error) {
+	return nil, errors.New("PKCS#11 is not supported by this build, rebuild tape with '-tags pkcs11'")
+}
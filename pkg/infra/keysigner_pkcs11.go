@@ -0,0 +1,55 @@
+//go:build pkcs11
+
+package infra
+
+import (
+	"crypto/x509"
+
+	"github.com/osdi23p228/fabric/bccsp"
+	"github.com/osdi23p228/fabric/bccsp/pkcs11"
+	"github.com/osdi23p228/fabric/bccsp/sw"
+	"github.com/pkg/errors"
+)
+
+// pkcs11Signer signs with a private key that never leaves the HSM
+type pkcs11Signer struct {
+	csp bccsp.BCCSP
+	key bccsp.Key
+}
+
+// newPKCS11Signer finds the private key matching the certificate in the token,
+// by the SKI derived from the public key as Fabric MSPs do
+func newPKCS11Signer(conf PKCS11Config, cert *x509.Certificate) (KeySigner, error) {
+	csp, err := pkcs11.New(pkcs11.PKCS11Opts{
+		SecLevel:   256,
+		HashFamily: "SHA2",
+		Library:    conf.Library,
+		Label:      conf.Label,
+		Pin:        conf.Pin,
+	}, sw.NewDummyKeyStore())
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to initialize PKCS#11 library %s", conf.Library)
+	}
+
+	publicKey, err := csp.KeyImport(cert, &bccsp.X509PublicKeyImportOpts{Temporary: true})
+	if err != nil {
+		return nil, errors.Wrap(err, "fail to import the public key of the certificate")
+	}
+
+	key, err := csp.GetKey(publicKey.SKI())
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to find the private key in token %s", conf.Label)
+	}
+	if !key.Private() {
+		return nil, errors.Errorf("private key matching the certificate is not found in token %s", conf.Label)
+	}
+
+	return &pkcs11Signer{
+		csp: csp,
+		key: key,
+	}, nil
+}
+
+func (s *pkcs11Signer) Sign(message []byte) ([]byte, error) {
+	return s.csp.Sign(s.key, digest(message), nil)
+}
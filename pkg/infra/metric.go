@@ -7,15 +7,26 @@ var (
 )
 
 type MetricInstance struct {
+	Valid int32
 	Abort int32
 }
 
 func NewMetricInstance() *MetricInstance {
 	return &MetricInstance{
+		Valid: 0,
 		Abort: 0,
 	}
 }
 
+func (m *MetricInstance) AddValid() {
+	atomic.AddInt32(&m.Valid, 1)
+}
+
 func (m *MetricInstance) AddAbort() {
 	atomic.AddInt32(&m.Abort, 1)
 }
+
+// Count returns the numbers of valid and aborted transactions so far
+func (m *MetricInstance) Count() (int32, int32) {
+	return atomic.LoadInt32(&m.Valid), atomic.LoadInt32(&m.Abort)
+}
@@ -0,0 +1,268 @@
+package infra
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/osdi23p228/fabric-protos-go/peer"
+	"github.com/osdi23p228/fabric/core/ledger/kvledger/txmgmt/rwsetutil"
+	"github.com/osdi23p228/fabric/protoutil"
+)
+
+const (
+	maxMismatchValueLength = 128 // values longer than this are truncated in the mismatch report
+)
+
+var (
+	mismatchKeepers MismatchKeepers
+)
+
+// MismatchKeepers records the transactions aborted because of mismatched endorsements
+type MismatchKeepers struct {
+	lock       sync.Mutex
+	mismatches []*EndorsementMismatch
+}
+
+// EndorsementMismatch describes how the endorsements of a transaction disagree
+type EndorsementMismatch struct {
+	Txid   string
+	Groups [][]string // endorsers grouped by identical ProposalResponsePayloads
+	Diffs  []string   // differing items, one line per item
+}
+
+func initMismatchKeepers() {
+	mismatchKeepers = MismatchKeepers{}
+}
+
+// keepMismatch diagnoses the responses of the element and records the mismatch if any
+func (mks *MismatchKeepers) keepMismatch(element *Element) {
+	mismatch := diagnoseMismatch(element.Txid, element.Responses)
+	if mismatch == nil {
+		return
+	}
+
+	id := txid2id[element.Txid]
+	logCh <- fmt.Sprintf("%-10s %d %4d %s %d", "Mismatch", time.Now().UnixNano(), id, element.Txid, len(mismatch.Groups))
+
+	mks.lock.Lock()
+	mks.mismatches = append(mks.mismatches, mismatch)
+	mks.lock.Unlock()
+}
+
+// report sends the mismatched endorsements to the report file
+func (mks *MismatchKeepers) report() {
+	mks.lock.Lock()
+	defer mks.lock.Unlock()
+
+	reportCh <- fmt.Sprintf("MISMATCHED Transactions: %d", len(mks.mismatches))
+	for _, mismatch := range mks.mismatches {
+		reportCh <- fmt.Sprintf("Mismatch of transaction %d %s:", txid2id[mismatch.Txid], mismatch.Txid)
+		for i, group := range mismatch.Groups {
+			reportCh <- fmt.Sprintf("  group %d: %s", i, strings.Join(group, ", "))
+		}
+		for _, diff := range mismatch.Diffs {
+			reportCh <- fmt.Sprintf("  %s", diff)
+		}
+	}
+}
+
+// diagnoseMismatch groups the endorsers by their ProposalResponsePayloads, decodes the payload
+// of each group and lists the items differing from the first group.
+// It returns nil if all payloads are identical
+func diagnoseMismatch(txid string, responses []*peer.ProposalResponse) *EndorsementMismatch {
+	var payloads [][]byte
+	var groups [][]string
+	for _, r := range responses {
+		endorser := getEndorserName(r)
+
+		found := false
+		for i, payload := range payloads {
+			if bytes.Equal(payload, r.Payload) {
+				groups[i] = append(groups[i], endorser)
+				found = true
+				break
+			}
+		}
+		if !found {
+			payloads = append(payloads, r.Payload)
+			groups = append(groups, []string{endorser})
+		}
+	}
+
+	if len(groups) < 2 {
+		return nil
+	}
+
+	mismatch := &EndorsementMismatch{
+		Txid:   txid,
+		Groups: groups,
+	}
+
+	items := make([]map[string]string, len(payloads))
+	for i, payload := range payloads {
+		items[i] = decodeResponsePayload(payload)
+	}
+
+	keys := make(map[string]bool)
+	for _, group := range items {
+		for key := range group {
+			keys[key] = true
+		}
+	}
+	var sortedKeys []string
+	for key := range keys {
+		sortedKeys = append(sortedKeys, key)
+	}
+	sort.Strings(sortedKeys)
+
+	for _, key := range sortedKeys {
+		differs := false
+		for _, group := range items[1:] {
+			if group[key] != items[0][key] {
+				differs = true
+				break
+			}
+		}
+		if !differs {
+			continue
+		}
+
+		values := make([]string, len(items))
+		for i, group := range items {
+			value, ok := group[key]
+			if !ok {
+				value = "<absent>"
+			}
+			values[i] = fmt.Sprintf("group %d=%s", i, value)
+		}
+		mismatch.Diffs = append(mismatch.Diffs, fmt.Sprintf("%s: %s", key, strings.Join(values, ", ")))
+	}
+
+	return mismatch
+}
+
+// decodeResponsePayload flattens a ProposalResponsePayload into items that can be compared
+// one by one, i.e. the chaincode response, the read-write set and the chaincode event
+func decodeResponsePayload(payload []byte) map[string]string {
+	items := make(map[string]string)
+
+	prp, err := protoutil.UnmarshalProposalResponsePayload(payload)
+	if err != nil {
+		items["payload"] = fmt.Sprintf("<undecodable: %v>", err)
+		return items
+	}
+
+	ccAction, err := protoutil.UnmarshalChaincodeAction(prp.Extension)
+	if err != nil {
+		items["action"] = fmt.Sprintf("<undecodable: %v>", err)
+		return items
+	}
+
+	items["chaincode"] = fmt.Sprintf("%s:%s", ccAction.GetChaincodeId().GetName(), ccAction.GetChaincodeId().GetVersion())
+	items["response.status"] = strconv.Itoa(int(ccAction.GetResponse().GetStatus()))
+	items["response.message"] = ccAction.GetResponse().GetMessage()
+	items["response.payload"] = formatMismatchValue(ccAction.GetResponse().GetPayload())
+
+	if len(ccAction.Events) > 0 {
+		event, err := protoutil.UnmarshalChaincodeEvents(ccAction.Events)
+		if err != nil {
+			items["event"] = fmt.Sprintf("<undecodable: %v>", err)
+		} else {
+			items["event.name"] = event.EventName
+			items["event.payload"] = formatMismatchValue(event.Payload)
+		}
+	}
+
+	txRWSet := &rwsetutil.TxRwSet{}
+	if err := txRWSet.FromProtoBytes(ccAction.Results); err != nil {
+		items["rwset"] = fmt.Sprintf("<undecodable: %v>", err)
+		return items
+	}
+
+	for _, nsRWSet := range txRWSet.NsRwSets {
+		ns := nsRWSet.NameSpace
+		for _, read := range nsRWSet.KvRwSet.GetReads() {
+			items[fmt.Sprintf("%s read %s", ns, read.Key)] = fmt.Sprintf("version(%d,%d)",
+				read.GetVersion().GetBlockNum(), read.GetVersion().GetTxNum())
+		}
+		for _, rq := range nsRWSet.KvRwSet.GetRangeQueriesInfo() {
+			items[fmt.Sprintf("%s range [%s,%s)", ns, rq.StartKey, rq.EndKey)] = fmt.Sprintf("itrExhausted(%t)", rq.ItrExhausted)
+		}
+		for _, write := range nsRWSet.KvRwSet.GetWrites() {
+			key := fmt.Sprintf("%s write %s", ns, write.Key)
+			if write.IsDelete {
+				items[key] = "<deleted>"
+			} else {
+				items[key] = formatMismatchValue(write.Value)
+			}
+		}
+
+		for _, coll := range nsRWSet.CollHashedRwSets {
+			for _, read := range coll.HashedRwSet.GetHashedReads() {
+				items[fmt.Sprintf("%s/%s read-hash %x", ns, coll.CollectionName, read.KeyHash)] = fmt.Sprintf("version(%d,%d)",
+					read.GetVersion().GetBlockNum(), read.GetVersion().GetTxNum())
+			}
+			for _, write := range coll.HashedRwSet.GetHashedWrites() {
+				key := fmt.Sprintf("%s/%s write-hash %x", ns, coll.CollectionName, write.KeyHash)
+				if write.IsDelete {
+					items[key] = "<deleted>"
+				} else {
+					items[key] = hex.EncodeToString(write.ValueHash)
+				}
+			}
+		}
+	}
+
+	return items
+}
+
+// getEndorserName returns "MSPID/CommonName" of the endorser of the response
+func getEndorserName(r *peer.ProposalResponse) string {
+	if r.Endorsement == nil {
+		return "<unknown>"
+	}
+
+	identity, err := protoutil.UnmarshalSerializedIdentity(r.Endorsement.Endorser)
+	if err != nil {
+		return "<unknown>"
+	}
+
+	block, _ := pem.Decode(identity.IdBytes)
+	if block == nil {
+		return identity.Mspid
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return identity.Mspid
+	}
+	return fmt.Sprintf("%s/%s", identity.Mspid, cert.Subject.CommonName)
+}
+
+// formatMismatchValue prints a value as a quoted string if it is valid UTF-8, otherwise in hex
+func formatMismatchValue(value []byte) string {
+	var s string
+	if utf8.Valid(value) {
+		s = strconv.Quote(string(value))
+	} else {
+		s = hex.EncodeToString(value)
+	}
+
+	if len(s) > maxMismatchValueLength {
+		// Cut at a rune boundary, since the quoted string keeps printable characters as they are
+		n := maxMismatchValueLength
+		for n > 0 && !utf8.RuneStart(s[n]) {
+			n--
+		}
+		s = s[:n] + "..."
+	}
+	return s
+}
@@ -1,20 +1,43 @@
 package infra
 
 import (
+	"context"
+	"sync"
 	"time"
 
+	"github.com/osdi23p228/fabric-protos-go/common"
+	"github.com/osdi23p228/fabric-protos-go/gateway"
 	"github.com/osdi23p228/fabric-protos-go/peer"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+)
+
+const (
+	observerMinBackoff = 100 * time.Millisecond
+	observerMaxBackoff = 10 * time.Second
 )
 
 type Observer struct {
-	client    peer.Deliver_DeliverFilteredClient
-	deliverCh chan *peer.DeliverResponse_FilteredBlock
+	gatewayClient gateway.GatewayClient // only used when checking commit status in 'gateway' mode
+	client        DeliverClient
+	conn          *grpc.ClientConn
+	lock          sync.Mutex
+	lastBlock     uint64 // number of the last block handed over to processBlock
+	deliverCh     chan *ObservedBlock
 }
 
 func NewObserver() *Observer {
-	deliverer, err := CreateDeliverFilteredClient()
-	if err != nil {
-		logger.Fatalf("Fail to create DeliverFilteredClient: %v", err)
+	o := &Observer{
+		deliverCh: make(chan *ObservedBlock),
+	}
+
+	if config.Mode == ModeGateway && config.CommitStatus {
+		gatewayClient, err := CreateGatewayClient(config.Gateway)
+		if err != nil {
+			logger.Fatalf("Fail to create GatewayClient: %v", err)
+		}
+		o.gatewayClient = gatewayClient
+		return o
 	}
 
 	envelope, err := CreateSignedDeliverNewestEnv()
@@ -22,18 +45,87 @@ func NewObserver() *Observer {
 		logger.Fatalf("Fail to create SignedEnvelope: %v", err)
 	}
 
-	if err = deliverer.Send(envelope); err != nil {
-		logger.Fatalf("Fail to send SignedEnvelope: %v", err)
+	if err = o.connect(envelope); err != nil {
+		logger.Fatalf("Fail to connect to committer %s: %v", config.Committer.Address, err)
 	}
 
-	// drain the first response
-	if _, err = deliverer.Recv(); err != nil {
+	// drain the first response, i.e. the newest block before the benchmark starts,
+	// and remember its number so that a reconnection resumes right after it
+	deliverResponse, err := o.client.Recv()
+	if err != nil {
 		logger.Fatalf("Fail to receive the first response: %v", err)
 	}
+	block := parseDeliverResponse(deliverResponse)
+	if block == nil {
+		logger.Fatalf("Expect a block as the first response, got %v", deliverResponse)
+	}
+	o.lastBlock = block.Number
+
+	return o
+}
+
+// connect creates a new deliver stream to the committer and sends the seek envelope through it
+func (o *Observer) connect(envelope *common.Envelope) error {
+	deliverer, conn, err := CreateDeliverClient()
+	if err != nil {
+		return errors.Wrap(err, "fail to create DeliverClient")
+	}
+
+	if err = deliverer.Send(envelope); err != nil {
+		conn.Close()
+		return errors.Wrap(err, "fail to send SignedEnvelope")
+	}
+
+	o.lock.Lock()
+	o.client = deliverer
+	o.conn = conn
+	o.lock.Unlock()
+
+	return nil
+}
+
+// close closes the current deliver stream and its connection
+func (o *Observer) close() {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if o.conn != nil {
+		o.client.CloseSend()
+		o.conn.Close()
+		o.conn = nil
+	}
+}
+
+// reconnect re-dials the committer with exponential backoff and seeks from the block
+// following the last processed one, so no block is lost across reconnections.
+// It returns false if the benchmark ends before a new stream is established
+func (o *Observer) reconnect() bool {
+	o.close()
 
-	return &Observer{
-		client:    deliverer,
-		deliverCh: make(chan *peer.DeliverResponse_FilteredBlock),
+	backoff := observerMinBackoff
+	for {
+		select {
+		case <-doneCh:
+			return false
+		case <-time.After(backoff):
+		}
+
+		envelope, err := CreateSignedDeliverSpecifiedEnv(o.lastBlock + 1)
+		if err != nil {
+			logger.Fatalf("Fail to create SignedEnvelope: %v", err)
+		}
+
+		err = o.connect(envelope)
+		if err == nil {
+			logger.Infof("Reconnect to committer %s and resume from block %d", config.Committer.Address, o.lastBlock+1)
+			return true
+		}
+		logger.Warnf("Fail to reconnect to committer %s: %v, retry in %v", config.Committer.Address, err, backoff)
+
+		backoff *= 2
+		if backoff > observerMaxBackoff {
+			backoff = observerMaxBackoff
+		}
 	}
 }
 
@@ -41,60 +133,180 @@ func NewObserver() *Observer {
 func (o *Observer) StartAsync() {
 	logger.Infof("Start observer")
 
-	// Process FilteredBlock
-	go o.processFilteredBlock()
+	// Process blocks
+	go o.processBlock()
 
-	go o.receiveFilteredBlock()
+	if o.gatewayClient != nil {
+		for i := 0; i < config.CommitStatusNum; i++ {
+			go o.checkCommitStatus()
+		}
+		return
+	}
+
+	go o.receiveBlock()
 }
 
-func (o *Observer) processFilteredBlock() {
-	var validTxNum int32 = 0
+func (o *Observer) processBlock() {
+	idleTimeout := time.Duration(config.IdleTime) * time.Second
+	idleTimer := time.NewTimer(idleTimeout)
+	defer idleTimer.Stop()
+
 	for {
 		select {
-		case fb := <-o.deliverCh:
-			for _, tx := range fb.FilteredBlock.FilteredTransactions {
-				timeKeepers.keepObservedTime(tx.GetTxid(), tx.TxValidationCode)
-			}
+		case block := <-o.deliverCh:
+			blockKeepers.keepBlock(block)
 
-			for _, tx := range fb.FilteredBlock.FilteredTransactions {
-				if tx.TxValidationCode == peer.TxValidationCode_VALID {
-					validTxNum += 1
+			for _, tx := range block.Transactions {
+				if _, ok := txid2id[tx.Txid]; !ok {
+					// Not generated in this run
+					continue
+				}
+				faultKeepers.keepReaction(tx.Txid, tx.ValidationCode.String())
+
+				if !timeKeepers.keepObservedTime(tx.Txid, tx.ValidationCode) {
+					// A duplicated txid whose first occurrence has been counted,
+					// or a transaction whose envelope has been rejected
+					continue
+				}
+
+				if tx.ValidationCode == peer.TxValidationCode_VALID {
+					Metric.AddValid()
+
+					// Like client SDKs, only deliver events of valid transactions
+					if event := getExpectedEvent(tx); event != nil {
+						timeKeepers.keepEventTime(tx.Txid, event.EventName)
+					}
 				} else {
 					Metric.AddAbort()
 				}
 			}
 
-			if validTxNum+Metric.Abort >= int32(config.TxNum) {
-				close(observerEndCh)
+			// Every transaction is either observed or aborted before broadcast
+			if valid, abort := Metric.Count(); valid+abort >= int32(config.TxNum) {
+				observerEndCh <- endReasonCompleted
 				return
 			}
-		case <-time.After(30 * time.Second):
-			close(observerEndCh)
+
+			if !idleTimer.Stop() {
+				<-idleTimer.C
+			}
+			idleTimer.Reset(idleTimeout)
+		case <-idleTimer.C:
+			logger.Warnf("No block is received in the last %v", idleTimeout)
+			observerEndCh <- endReasonIdleTimeout
 			return
 		case <-doneCh:
-			o.client.CloseSend()
+			o.close()
 			return
 		}
 	}
 }
 
-func (o *Observer) receiveFilteredBlock() {
+// receiveBlock receives blocks from the committer and reconnects whenever
+// the deliver stream breaks, e.g. because of a peer restart or a network blip
+func (o *Observer) receiveBlock() {
 	for {
-		deliverResponse, err := o.client.Recv()
+		o.lock.Lock()
+		client := o.client
+		o.lock.Unlock()
+
+		deliverResponse, err := client.Recv()
 		if err != nil {
-			logger.Fatalln("Fail to receive deliver response: %v", err)
-		}
-		if deliverResponse == nil {
-			logger.Fatalln("Received a nil DeliverResponse")
+			select {
+			case <-doneCh:
+				return
+			default:
+			}
+
+			logger.Warnf("Fail to receive deliver response: %v", err)
+			if !o.reconnect() {
+				return
+			}
+			continue
 		}
 
 		switch t := deliverResponse.Type.(type) {
-		case *peer.DeliverResponse_FilteredBlock:
-			o.deliverCh <- t
+		case *peer.DeliverResponse_FilteredBlock, *peer.DeliverResponse_Block, *peer.DeliverResponse_BlockAndPrivateData:
+			block := parseDeliverResponse(deliverResponse)
+			if block.Number <= o.lastBlock {
+				// Already processed before the reconnection
+				continue
+			}
+
+			select {
+			case o.deliverCh <- block:
+				o.lastBlock = block.Number
+			case <-doneCh:
+				return
+			}
 		case *peer.DeliverResponse_Status:
-			logger.Infoln("Status:", t.Status)
+			// The server always ends the stream after sending a status
+			logger.Warnf("Deliver stream is terminated with status %s", t.Status)
+			if !o.reconnect() {
+				return
+			}
 		default:
 			logger.Infoln("Unknown DeliverResponse type")
 		}
 	}
 }
+
+// checkCommitStatus waits for the commit of every submitted transaction through the gateway,
+// and hands the result over to processBlock as a block with a single transaction
+func (o *Observer) checkCommitStatus() {
+	for {
+		select {
+		case element := <-submittedCh:
+			request, err := CreateSignedCommitStatusRequest(element.Txid)
+			if err != nil {
+				logger.Fatalf("Fail to create SignedCommitStatusRequest: %v", err)
+			}
+
+			// The request waits for the commit, so it has no deadline
+			var resp *gateway.CommitStatusResponse
+			err = retryTransient(context.Background(), 0, func(ctx context.Context) error {
+				var err error
+				resp, err = o.gatewayClient.CommitStatus(ctx, request)
+				return err
+			})
+
+			// If the status is unknown, an empty block still lets processBlock check whether every transaction is done
+			block := &ObservedBlock{}
+			if err != nil {
+				logger.Errorf("Fail to get commit status of transaction %s: %v", element.Txid, err)
+				Metric.AddAbort()
+				timeKeepers.keepAbortedTime(element.Txid)
+			} else {
+				block = &ObservedBlock{
+					Number: resp.BlockNumber,
+					Transactions: []*ObservedTransaction{
+						{Txid: element.Txid, ValidationCode: resp.Result},
+					},
+				}
+			}
+
+			select {
+			case o.deliverCh <- block:
+			case <-doneCh:
+				return
+			}
+		case <-doneCh:
+			return
+		}
+	}
+}
+
+// getExpectedEvent returns the first chaincode event of the transaction
+// matching the configured event name, or nil if no event is expected
+func getExpectedEvent(tx *ObservedTransaction) *peer.ChaincodeEvent {
+	if !config.ObserveEvent {
+		return nil
+	}
+
+	for _, event := range tx.Events {
+		if config.EventName == "" || event.EventName == config.EventName {
+			return event
+		}
+	}
+	return nil
+}
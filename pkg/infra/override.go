@@ -0,0 +1,379 @@
+package infra
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	envOverridePrefix = "TAPE_"
+	redactedValue     = "******"
+)
+
+var (
+	// environment variables with the prefix which are not config fields
+	envOverrideIgnored = map[string]bool{
+		"TAPE_LOGLEVEL": true,
+	}
+
+	// config fields never dumped into the report
+	secretKeys = map[string]bool{
+		"pin": true,
+	}
+)
+
+// Override sets the config field at the path to the value in YAML, applied on top of the configuration file.
+// The path consists of the YAML keys separated by '.' and indexes in brackets, e.g. "endorsers[0].address"
+type Override struct {
+	Path  string
+	Value string
+}
+
+// ParseOverride parses an override in the form of "path=value", e.g. "rate=500"
+func ParseOverride(s string) (Override, error) {
+	i := strings.Index(s, "=")
+	if i <= 0 {
+		return Override{}, errors.Errorf("override %s is not in the form of 'path=value'", s)
+	}
+	return Override{Path: s[:i], Value: s[i+1:]}, nil
+}
+
+// GetEnvOverrides returns the overrides in the environment variables sorted by name, whose names are
+// the prefix "TAPE_" followed by the path with '_' as the separator, e.g. TAPE_RATE or TAPE_ENDORSERS_0_ADDRESS.
+// Variables not naming a config field, e.g. the one holding a PIN, are ignored
+func GetEnvOverrides() []Override {
+	var names []string
+	var overrides []Override
+	for _, env := range os.Environ() {
+		i := strings.Index(env, "=")
+		if i < 0 {
+			continue
+		}
+		name, value := env[:i], env[i+1:]
+		if !strings.HasPrefix(name, envOverridePrefix) || envOverrideIgnored[name] {
+			continue
+		}
+
+		var segments []string
+		for _, s := range strings.Split(name[len(envOverridePrefix):], "_") {
+			if _, err := strconv.Atoi(s); err == nil {
+				s = "[" + s + "]"
+			} else {
+				s = "." + s
+			}
+			segments = append(segments, s)
+		}
+		path := strings.TrimPrefix(strings.Join(segments, ""), ".")
+		if _, _, err := resolveOverridePath(path); err != nil {
+			fmt.Printf("Ignore environment variable %s: %v\n", name, err)
+			continue
+		}
+		names = append(names, name)
+		overrides = append(overrides, Override{Path: path, Value: value})
+	}
+
+	sort.Sort(envOverrides{names, overrides})
+	return overrides
+}
+
+// envOverrides sorts the overrides by the names of their environment variables, where numeric segments
+// are compared as numbers, so that TAPE_ARGS_2 is applied before TAPE_ARGS_10
+type envOverrides struct {
+	names     []string
+	overrides []Override
+}
+
+func (e envOverrides) Len() int {
+	return len(e.names)
+}
+
+func (e envOverrides) Swap(i, j int) {
+	e.names[i], e.names[j] = e.names[j], e.names[i]
+	e.overrides[i], e.overrides[j] = e.overrides[j], e.overrides[i]
+}
+
+func (e envOverrides) Less(i, j int) bool {
+	a, b := strings.Split(e.names[i], "_"), strings.Split(e.names[j], "_")
+	for k := 0; k < len(a) && k < len(b); k++ {
+		if a[k] == b[k] {
+			continue
+		}
+		x, errX := strconv.Atoi(a[k])
+		y, errY := strconv.Atoi(b[k])
+		if errX == nil && errY == nil {
+			return x < y
+		}
+		return a[k] < b[k]
+	}
+	return len(a) < len(b)
+}
+
+// pathSegment is either a key of a mapping or an index of a sequence
+type pathSegment struct {
+	key   string
+	index int
+}
+
+// resolveOverridePath splits the path into segments, matching the keys against the YAML keys
+// of the config fields case-insensitively, and returns the segments with the canonical keys
+// along with the type of the field at the path
+func resolveOverridePath(path string) ([]pathSegment, reflect.Type, error) {
+	var segments []pathSegment
+	t := reflect.TypeOf(Config{})
+
+	for _, part := range strings.Split(path, ".") {
+		key := part
+		var indexes []string
+		if i := strings.Index(part, "["); i >= 0 {
+			if !strings.HasSuffix(part, "]") {
+				return nil, nil, errors.Errorf("path %s has unclosed brackets", path)
+			}
+			key = part[:i]
+			indexes = strings.Split(part[i+1:len(part)-1], "][")
+		}
+
+		if t.Kind() != reflect.Struct {
+			return nil, nil, errors.Errorf("%s of path %s is not a field", part, path)
+		}
+		field, ok := findYAMLField(t, key)
+		if !ok {
+			return nil, nil, errors.Errorf("field %s of path %s is not found", key, path)
+		}
+		segments = append(segments, pathSegment{key: field.key, index: -1})
+		t = field.typ
+
+		for _, s := range indexes {
+			index, err := strconv.Atoi(s)
+			if err != nil || index < 0 {
+				return nil, nil, errors.Errorf("index %s of path %s is not a non-negative number", s, path)
+			}
+			if t.Kind() != reflect.Slice {
+				return nil, nil, errors.Errorf("%s of path %s is not a list", key, path)
+			}
+			segments = append(segments, pathSegment{index: index})
+			t = t.Elem()
+		}
+	}
+
+	return segments, t, nil
+}
+
+type yamlField struct {
+	key string
+	typ reflect.Type
+}
+
+// findYAMLField returns the field with the YAML key, where only the fields tagged with a key can be overridden
+func findYAMLField(t reflect.Type, key string) (yamlField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := strings.Split(f.Tag.Get("yaml"), ",")[0]
+		if tag == "" || tag == "-" || !strings.EqualFold(tag, key) {
+			continue
+		}
+
+		typ := f.Type
+		if typ.Kind() == reflect.Ptr {
+			typ = typ.Elem()
+		}
+		return yamlField{key: tag, typ: typ}, true
+	}
+	return yamlField{}, false
+}
+
+// applyOverride sets the value at the segments in the YAML node, creating the missing mappings.
+// A list is extended if the index is right after its last item
+func applyOverride(node *yaml.Node, segments []pathSegment, value *yaml.Node) (*yaml.Node, error) {
+	if len(segments) == 0 {
+		return value, nil
+	}
+	if isNullNode(node) {
+		node = nil
+	}
+
+	s := segments[0]
+	if s.index < 0 {
+		if node == nil {
+			node = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		}
+		if node.Kind != yaml.MappingNode {
+			return nil, errors.Errorf("%s is not under a mapping", s.key)
+		}
+
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == s.key {
+				child, err := applyOverride(node.Content[i+1], segments[1:], value)
+				if err != nil {
+					return nil, err
+				}
+				node.Content[i+1] = child
+				return node, nil
+			}
+		}
+
+		child, err := applyOverride(nil, segments[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: s.key}
+		node.Content = append(node.Content, key, child)
+		return node, nil
+	}
+
+	if node == nil {
+		node = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	}
+	if node.Kind != yaml.SequenceNode {
+		return nil, errors.Errorf("index %d is not under a list", s.index)
+	}
+	if s.index > len(node.Content) {
+		return nil, errors.Errorf("index %d is out of the list of %d items", s.index, len(node.Content))
+	}
+	if s.index == len(node.Content) {
+		node.Content = append(node.Content, nil)
+	}
+
+	child, err := applyOverride(node.Content[s.index], segments[1:], value)
+	if err != nil {
+		return nil, err
+	}
+	node.Content[s.index] = child
+	return node, nil
+}
+
+func isNullNode(node *yaml.Node) bool {
+	return node == nil || node.Kind == 0 || node.Kind == yaml.ScalarNode && node.ShortTag() == "!!null"
+}
+
+// parseOverrideValue parses the value as YAML, e.g. "500" is a number and "[a, b]" is a list,
+// except that the strings of the type are kept as they are, e.g. "1.0" for a string field
+func parseOverrideValue(value string, typ reflect.Type) (*yaml.Node, error) {
+	if typ.Kind() == reflect.String {
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}, nil
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(value), &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null"}, nil
+	}
+	node := doc.Content[0]
+	keepStrings(node, typ)
+	return node, nil
+}
+
+// keepStrings tags the scalars in the node which are decoded into strings of the type as strings,
+// so that they are not turned into other values, e.g. "on" into true, when the document is encoded
+func keepStrings(node *yaml.Node, typ reflect.Type) {
+	switch typ.Kind() {
+	case reflect.Ptr:
+		keepStrings(node, typ.Elem())
+	case reflect.String:
+		if node.Kind == yaml.ScalarNode && !isNullNode(node) {
+			node.Tag = "!!str"
+		}
+	case reflect.Slice:
+		if node.Kind == yaml.SequenceNode {
+			for _, child := range node.Content {
+				keepStrings(child, typ.Elem())
+			}
+		}
+	case reflect.Map:
+		if node.Kind == yaml.MappingNode {
+			for i := 1; i < len(node.Content); i += 2 {
+				keepStrings(node.Content[i], typ.Elem())
+			}
+		}
+	case reflect.Struct:
+		if node.Kind == yaml.MappingNode {
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if field, ok := findYAMLField(typ, node.Content[i].Value); ok {
+					keepStrings(node.Content[i+1], field.typ)
+				}
+			}
+		}
+	}
+}
+
+// applyOverrides applies the overrides in order to the YAML document. The document is edited as a tree
+// of nodes, so that the values not overridden keep their original text
+func applyOverrides(raw []byte, overrides []Override) ([]byte, error) {
+	if len(overrides) == 0 {
+		return raw, nil
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	var root *yaml.Node
+	if len(doc.Content) > 0 {
+		root = doc.Content[0]
+	}
+
+	for _, o := range overrides {
+		segments, typ, err := resolveOverridePath(o.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := parseOverrideValue(o.Value, typ)
+		if err != nil {
+			return nil, errors.Wrapf(err, "fail to parse value of %s", o.Path)
+		}
+
+		root, err = applyOverride(root, segments, value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "fail to override %s", o.Path)
+		}
+	}
+
+	return yaml.Marshal(root)
+}
+
+// redactSecrets replaces the secrets in the YAML node
+func redactSecrets(node *yaml.Node) {
+	if node == nil {
+		return
+	}
+	for i, child := range node.Content {
+		if node.Kind == yaml.MappingNode && i%2 == 1 && secretKeys[strings.ToLower(node.Content[i-1].Value)] && !isNullNode(child) {
+			node.Content[i] = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: redactedValue}
+			continue
+		}
+		redactSecrets(child)
+	}
+}
+
+// reportEffectiveConfig sends the configuration file with the overrides applied to the report file,
+// so that the run can be reproduced
+func reportEffectiveConfig() {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(config.effective, &doc); err != nil {
+		logger.Errorf("Fail to dump effective config: %v", err)
+		return
+	}
+	redactSecrets(&doc)
+
+	b := &strings.Builder{}
+	encoder := yaml.NewEncoder(b)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		logger.Errorf("Fail to dump effective config: %v", err)
+		return
+	}
+
+	reportCh <- fmt.Sprintf("Effective Config:")
+	for _, line := range strings.Split(strings.TrimRight(b.String(), "\n"), "\n") {
+		reportCh <- fmt.Sprintf("  %s", line)
+	}
+}
@@ -0,0 +1,83 @@
+package infra
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+// TestApplyOverridesKeepsStrings expects the values of string fields not to be parsed as YAML,
+// and the values not overridden to keep their original text
+func TestApplyOverridesKeepsStrings(t *testing.T) {
+	base := []byte("channel: mychannel\nversion: 1.0\nchaincode: 0123\n")
+
+	for _, tc := range []struct {
+		overrides []Override
+		version   string
+		channel   string
+		args      []string
+	}{
+		{
+			overrides: []Override{{Path: "rate", Value: "500"}},
+			version:   "1.0",
+			channel:   "mychannel",
+		},
+		{
+			overrides: []Override{
+				{Path: "version", Value: "2.0"},
+				{Path: "channel", Value: "0123"},
+				{Path: "args", Value: "[on, 1.0, 0123]"},
+				{Path: "args[3]", Value: "off"},
+				{Path: "rate", Value: "500"},
+			},
+			version: "2.0",
+			channel: "0123",
+			args:    []string{"on", "1.0", "0123", "off"},
+		},
+	} {
+		raw, err := applyOverrides(base, tc.overrides)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c := &Config{}
+		if err = yaml.Unmarshal(raw, c); err != nil {
+			t.Fatal(err)
+		}
+		if c.Version != tc.version || c.Channel != tc.channel || c.Chaincode != "0123" || c.Rate != 500 {
+			t.Fatalf("Expect version %s, channel %s, chaincode 0123 and rate 500, got %s, %s, %s and %d",
+				tc.version, tc.channel, c.Version, c.Channel, c.Chaincode, c.Rate)
+		}
+		if !reflect.DeepEqual(c.Args, tc.args) {
+			t.Fatalf("Expect arguments %q, got %q", tc.args, c.Args)
+		}
+	}
+}
+
+// TestGetEnvOverrides expects unknown variables to be ignored and indexes to be ordered as numbers
+func TestGetEnvOverrides(t *testing.T) {
+	for i := 0; i < 12; i++ {
+		t.Setenv("TAPE_ARGS_"+strconv.Itoa(i), strconv.Itoa(i))
+	}
+	t.Setenv("TAPE_PIN", "1234")
+
+	raw, err := applyOverrides([]byte("channel: mychannel\n"), GetEnvOverrides())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Config{}
+	if err = yaml.Unmarshal(raw, c); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Args) != 12 || c.Args[10] != "10" {
+		t.Fatalf("Expect 12 arguments in order, got %v", c.Args)
+	}
+
+	for _, o := range GetEnvOverrides() {
+		if o.Path == "PIN" {
+			t.Fatalf("Expect TAPE_PIN to be ignored")
+		}
+	}
+}
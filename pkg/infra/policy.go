@@ -0,0 +1,278 @@
+package infra
+
+import (
+	"math/rand"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/osdi23p228/fabric-protos-go/common"
+	"github.com/osdi23p228/fabric-protos-go/msp"
+	"github.com/osdi23p228/fabric-protos-go/peer"
+	"github.com/osdi23p228/fabric/common/policydsl"
+	"github.com/osdi23p228/fabric/protoutil"
+	"github.com/pkg/errors"
+)
+
+// Strategies of choosing a satisfying set of organizations for a transaction
+const (
+	SelectionRoundRobin = "roundRobin"
+	SelectionRandom     = "random"
+)
+
+// EndorsementPolicy decides which endorsers a transaction is sent to, and
+// whether the collected endorsements satisfy the policy.
+// A policy is evaluated at the organization level, i.e. an endorsement from
+// any peer of an organization satisfies every principal of that organization
+type EndorsementPolicy struct {
+	rule          *common.SignaturePolicy // nil if the policy is given by discovered layouts
+	principalOrgs []string                // MSP ID of each principal referenced by the rule
+	layouts       [][]string              // minimal sets of organizations satisfying the policy
+	orgEndorsers  map[string][]int        // indexes of the endorsers of each organization
+	selection     string
+	nextLayout    int            // round-robin index of layouts
+	nextEndorser  map[string]int // round-robin index of endorsers of each organization
+}
+
+// NewEndorsementPolicy parses a policy expression, e.g. "OutOf(2, 'Org1MSP.peer', 'Org2MSP.peer', 'Org3MSP.peer')",
+// and computes the minimal sets of organizations satisfying it with the given endorsers
+func NewEndorsementPolicy(expression string, endorsers []Node, selection string) (*EndorsementPolicy, error) {
+	envelope, err := policydsl.FromString(expression)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to parse endorsement policy %s", expression)
+	}
+
+	p := &EndorsementPolicy{
+		rule:         envelope.Rule,
+		orgEndorsers: make(map[string][]int),
+		selection:    selection,
+		nextEndorser: make(map[string]int),
+	}
+
+	for _, principal := range envelope.Identities {
+		org, err := getPrincipalOrg(principal)
+		if err != nil {
+			return nil, err
+		}
+		p.principalOrgs = append(p.principalOrgs, org)
+	}
+
+	orgs, err := p.groupEndorsers(endorsers)
+	if err != nil {
+		return nil, err
+	}
+
+	p.layouts = p.computeLayouts(orgs)
+	if len(p.layouts) == 0 {
+		return nil, errors.Errorf("endorsement policy %s cannot be satisfied by the endorsers", expression)
+	}
+
+	return p, nil
+}
+
+// NewEndorsementPolicyFromLayouts builds a policy from the sets of organizations returned by
+// the discovery service. The layouts some of whose organizations have no endorser are dropped
+func NewEndorsementPolicyFromLayouts(layouts [][]string, endorsers []Node, selection string) (*EndorsementPolicy, error) {
+	p := &EndorsementPolicy{
+		orgEndorsers: make(map[string][]int),
+		selection:    selection,
+		nextEndorser: make(map[string]int),
+	}
+
+	if _, err := p.groupEndorsers(endorsers); err != nil {
+		return nil, err
+	}
+
+	for _, layout := range layouts {
+		available := len(layout) > 0
+		for _, org := range layout {
+			if len(p.orgEndorsers[org]) == 0 {
+				available = false
+				break
+			}
+		}
+		if available {
+			p.layouts = append(p.layouts, layout)
+		}
+	}
+	if len(p.layouts) == 0 {
+		return nil, errors.New("no discovered layout can be satisfied by the endorsers")
+	}
+
+	return p, nil
+}
+
+// groupEndorsers groups the endorsers by organization and returns the organizations in order of appearance
+func (p *EndorsementPolicy) groupEndorsers(endorsers []Node) ([]string, error) {
+	var orgs []string
+	for i, endorser := range endorsers {
+		if endorser.MSPID == "" {
+			return nil, errors.Errorf("MSP ID of endorser %s is required by the endorsement policy", endorser.Address)
+		}
+		if _, ok := p.orgEndorsers[endorser.MSPID]; !ok {
+			orgs = append(orgs, endorser.MSPID)
+		}
+		p.orgEndorsers[endorser.MSPID] = append(p.orgEndorsers[endorser.MSPID], i)
+	}
+	return orgs, nil
+}
+
+func getPrincipalOrg(principal *msp.MSPPrincipal) (string, error) {
+	switch principal.PrincipalClassification {
+	case msp.MSPPrincipal_ROLE:
+		role := &msp.MSPRole{}
+		if err := proto.Unmarshal(principal.Principal, role); err != nil {
+			return "", errors.Wrap(err, "error unmarshaling MSPRole")
+		}
+		return role.MspIdentifier, nil
+	case msp.MSPPrincipal_ORGANIZATION_UNIT:
+		ou := &msp.OrganizationUnit{}
+		if err := proto.Unmarshal(principal.Principal, ou); err != nil {
+			return "", errors.Wrap(err, "error unmarshaling OrganizationUnit")
+		}
+		return ou.MspIdentifier, nil
+	case msp.MSPPrincipal_IDENTITY:
+		identity, err := protoutil.UnmarshalSerializedIdentity(principal.Principal)
+		if err != nil {
+			return "", err
+		}
+		return identity.Mspid, nil
+	default:
+		return "", errors.Errorf("unsupported principal classification %s", principal.PrincipalClassification)
+	}
+}
+
+// computeLayouts enumerates the subsets of the organizations and keeps
+// the satisfying ones none of whose proper subsets is satisfying
+func (p *EndorsementPolicy) computeLayouts(orgs []string) [][]string {
+	var satisfying []uint
+	for set := uint(1); set < 1<<uint(len(orgs)); set++ {
+		if p.IsSatisfiedBy(subsetOrgs(orgs, set)) {
+			satisfying = append(satisfying, set)
+		}
+	}
+
+	var layouts [][]string
+	for _, set := range satisfying {
+		minimal := true
+		for _, other := range satisfying {
+			if other != set && other&set == other {
+				minimal = false
+				break
+			}
+		}
+		if minimal {
+			var layout []string
+			for i, org := range orgs {
+				if set&(1<<uint(i)) != 0 {
+					layout = append(layout, org)
+				}
+			}
+			layouts = append(layouts, layout)
+		}
+	}
+
+	return layouts
+}
+
+func subsetOrgs(orgs []string, set uint) map[string]bool {
+	result := make(map[string]bool)
+	for i, org := range orgs {
+		if set&(1<<uint(i)) != 0 {
+			result[org] = true
+		}
+	}
+	return result
+}
+
+// IsSatisfiedBy returns true if the endorsements from the organizations satisfy the policy
+func (p *EndorsementPolicy) IsSatisfiedBy(orgs map[string]bool) bool {
+	if p.rule != nil {
+		return p.evaluate(p.rule, orgs)
+	}
+
+	for _, layout := range p.layouts {
+		satisfied := true
+		for _, org := range layout {
+			if !orgs[org] {
+				satisfied = false
+				break
+			}
+		}
+		if satisfied {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *EndorsementPolicy) evaluate(rule *common.SignaturePolicy, orgs map[string]bool) bool {
+	switch t := rule.Type.(type) {
+	case *common.SignaturePolicy_SignedBy:
+		return int(t.SignedBy) < len(p.principalOrgs) && orgs[p.principalOrgs[t.SignedBy]]
+	case *common.SignaturePolicy_NOutOf_:
+		n := 0
+		for _, r := range t.NOutOf.Rules {
+			if p.evaluate(r, orgs) {
+				n++
+			}
+		}
+		return n >= int(t.NOutOf.N)
+	default:
+		return false
+	}
+}
+
+// SelectEndorsers chooses a minimal satisfying set of organizations according to the selection
+// strategy, and one endorser of each organization in a round-robin way.
+// It is not safe for concurrent use
+func (p *EndorsementPolicy) SelectEndorsers() []int {
+	var layout []string
+	if p.selection == SelectionRandom {
+		layout = p.layouts[rand.Intn(len(p.layouts))]
+	} else {
+		layout = p.layouts[p.nextLayout]
+		p.nextLayout = (p.nextLayout + 1) % len(p.layouts)
+	}
+
+	endorsers := make([]int, len(layout))
+	for i, org := range layout {
+		candidates := p.orgEndorsers[org]
+		endorsers[i] = candidates[p.nextEndorser[org]]
+		p.nextEndorser[org] = (p.nextEndorser[org] + 1) % len(candidates)
+	}
+	return endorsers
+}
+
+// AverageLayoutSize returns the average number of endorsements requested per transaction
+func (p *EndorsementPolicy) AverageLayoutSize() float64 {
+	total := 0
+	for _, layout := range p.layouts {
+		total += len(layout)
+	}
+	return float64(total) / float64(len(p.layouts))
+}
+
+// isEndorsementEnough returns true if the collected responses are enough for assembling the transaction
+func isEndorsementEnough(responses []*peer.ProposalResponse) bool {
+	if config.Policy == nil {
+		return len(responses) >= config.EndorserNum
+	}
+
+	orgs := make(map[string]bool)
+	for _, r := range responses {
+		identity, err := protoutil.UnmarshalSerializedIdentity(r.Endorsement.Endorser)
+		if err != nil {
+			logger.Errorf("Fail to get the endorser identity: %v", err)
+			continue
+		}
+		orgs[identity.Mspid] = true
+	}
+	return config.Policy.IsSatisfiedBy(orgs)
+}
+
+// endorsementsPerTx returns the average number of proposals sent for each transaction
+func endorsementsPerTx() float64 {
+	if config.Policy == nil {
+		return float64(config.EndorserNum)
+	}
+	return config.Policy.AverageLayoutSize()
+}
@@ -14,6 +14,13 @@ const (
 	endorsementFilename = "ENDORSEMENT.txt"
 )
 
+// Reasons why a run ends
+const (
+	endReasonCompleted      = "completed"
+	endReasonIdleTimeout    = "idle timeout"
+	endReasonOverallTimeout = "overall timeout"
+)
+
 var (
 	txid2id map[string]int
 	config  *Config
@@ -27,7 +34,8 @@ var (
 	signedChs     []chan *Element
 	endorsedCh    chan *Element
 	integratedCh  chan *Element
-	observerEndCh chan struct{}
+	submittedCh   chan *Element
+	observerEndCh chan string
 	doneCh        chan struct{}
 )
 
@@ -43,7 +51,10 @@ func Process(c *Config, l *log.Logger) {
 	config = c
 	logger = l
 
-	if config.End2End {
+	if config.DryRun {
+		logger.Info("Test Mode: Dry Run")
+		DryRun()
+	} else if config.End2End {
 		logger.Info("Test Mode: End To End")
 		End2End()
 	} else {
@@ -56,6 +67,10 @@ func Process(c *Config, l *log.Logger) {
 //	Start: timestamp txid-index txid  endorser-id, connection-id, client-id
 //	Proposal: timestamp txid-index txid  endorser-id, connection-id, client-id
 //	Broadcast: timestamp txid-index txid  broadcaster-id
+//	Aborted: timestamp txid-index txid
+//	Mismatch: txid-index txid number-of-differing-payloads
+//	Event: timestamp txid-index txid event-name
+//	Block: timestamp block-number transaction-num block-size (only in 'block' and 'privateData' deliver types)
 //	End: timestamp txid-index txid [VALID/MVCC]
 //	Number of all transactions: total-transaction-num
 //	Number of VALID transactions: valid-transaction-num
@@ -143,8 +158,20 @@ func NewIntegratedChannel() chan *Element {
 	return integratedCh
 }
 
-func NewObserverEndChannel() chan struct{} {
-	observerEndCh := make(chan struct{})
+func NewSubmittedChannel() chan *Element {
+	// submittedCh stores all transactions submitted to the gateway
+	// but not yet checked for commit status
+	// Sender: broadcasters
+	// Receiver: observer (only if checking commit status in 'gateway' mode)
+	submittedCh := make(chan *Element, CH_MAX_CAPACITY)
+	return submittedCh
+}
+
+func NewObserverEndChannel() chan string {
+	// observerEndCh receives the reason why the observer ends
+	// Sender: observer
+	// Receiver: WaitObserverEnd
+	observerEndCh := make(chan string, 1)
 	return observerEndCh
 }
 
@@ -160,64 +187,114 @@ func initChannels() {
 	signedChs = NewSignedChannel()
 	endorsedCh = NewEndorsedChannel()
 	integratedCh = NewIntegratedChannel()
+	submittedCh = NewSubmittedChannel()
 	observerEndCh = NewObserverEndChannel()
 	doneCh = initDoneChannel()
 }
 
 func WaitObserverEnd(startTime time.Time, printWG *sync.WaitGroup) {
+	// A nil channel blocks forever, i.e. no overall timeout
+	var overallTimeoutCh <-chan time.Time
+	if config.TxTime > 0 {
+		overallTimeoutCh = time.After(time.Duration(config.TxTime) * time.Second)
+	}
+
+	var endReason string
 	select {
-	case <-observerEndCh:
-		duration := time.Since(startTime)
-		logger.Infof("Finish processing transactions")
-
-		reportCh <- fmt.Sprintf("ALL Transactions: %d", config.TxNum)
-		reportCh <- fmt.Sprintf("VALID Transactions: %d", int32(config.TxNum)-Metric.Abort)
-		reportCh <- fmt.Sprintf("ABORTED Transactions: %d", Metric.Abort)
-		reportCh <- fmt.Sprintf("Duration: %.3fs", float64(duration.Milliseconds())/float64(1e3))
-		reportCh <- fmt.Sprintf("TPS: %.3f", float64(config.TxNum)*1e9/float64(duration.Nanoseconds()))
-		reportCh <- fmt.Sprintf("Effective TPS: %.3f", float64(int32(config.TxNum)-Metric.Abort)*1e9/float64(duration.Nanoseconds()))
-		reportCh <- fmt.Sprintf("Abort Rate: %.3f%%", float64(Metric.Abort)/float64(config.TxNum)*100)
-		reportCh <- fmt.Sprintf("Average Commit Latency: %.3fs", timeKeepers.getAverageTotalLatency())
-		reportCh <- fmt.Sprintf("Average Endorse Latency: %.3fs", timeKeepers.getAverageEndorseLatency())
-		reportCh <- fmt.Sprintf("Average Order&Commit Latency: %.3fs", timeKeepers.getAverageOrderCommitLatency())
-
-		percentiles := []int{50, 55, 60, 65, 70, 75, 80, 85, 90, 91, 92, 93, 94, 95, 96, 97, 98, 99, 100}
+	case endReason = <-observerEndCh:
+	case <-overallTimeoutCh:
+		logger.Warnf("Reach the maximum execution time %ds", config.TxTime)
+		endReason = endReasonOverallTimeout
+	}
+
+	duration := time.Since(startTime)
+	logger.Infof("Finish processing transactions: %s", endReason)
+
+	// On timeouts the stages are still running until 'doneCh' is closed below,
+	// so the records are frozen first to be reported consistently
+	timeKeepers.stop()
+	blockKeepers.stop()
+
+	valid, aborted := timeKeepers.getValidAndAbortedNum()
+	unobserved := timeKeepers.getUnobservedTransactions()
+
+	reportCh <- fmt.Sprintf("End Reason: %s", endReason)
+	reportCh <- fmt.Sprintf("ALL Transactions: %d", config.TxNum)
+	reportCh <- fmt.Sprintf("VALID Transactions: %d", valid)
+	reportCh <- fmt.Sprintf("ABORTED Transactions: %d", aborted)
+	reportCh <- fmt.Sprintf("UNOBSERVED Transactions: %d", len(unobserved))
+	reportCh <- fmt.Sprintf("Duration: %.3fs", float64(duration.Milliseconds())/float64(1e3))
+	reportCh <- fmt.Sprintf("TPS: %.3f", float64(config.TxNum)*1e9/float64(duration.Nanoseconds()))
+	reportCh <- fmt.Sprintf("Effective TPS: %.3f", float64(valid)*1e9/float64(duration.Nanoseconds()))
+	reportCh <- fmt.Sprintf("Abort Rate: %.3f%%", float64(aborted)/float64(config.TxNum)*100)
+	reportCh <- fmt.Sprintf("Average Commit Latency: %.3fs", timeKeepers.getAverageTotalLatency())
+	reportCh <- fmt.Sprintf("Average Endorse Latency: %.3fs", timeKeepers.getAverageEndorseLatency())
+	reportCh <- fmt.Sprintf("Average Order&Commit Latency: %.3fs", timeKeepers.getAverageOrderCommitLatency())
+
+	percentiles := []int{50, 55, 60, 65, 70, 75, 80, 85, 90, 91, 92, 93, 94, 95, 96, 97, 98, 99, 100}
+	for _, i := range percentiles {
+		reportCh <- fmt.Sprintf("Commit Latency [%d%%]: %.3fs", i, timeKeepers.getCommitLatencyOfPercentile(i))
+	}
+
+	if config.ObserveEvent {
+		reportCh <- fmt.Sprintf("EVENT Transactions: %d", timeKeepers.getEventNum())
+		reportCh <- fmt.Sprintf("Average Event Latency: %.3fs", timeKeepers.getAverageEventLatency())
 		for _, i := range percentiles {
-			reportCh <- fmt.Sprintf("Commit Latency [%d%%]: %.3fs", i, timeKeepers.getCommitLatencyOfPercentile(i))
+			reportCh <- fmt.Sprintf("Event Latency [%d%%]: %.3fs", i, timeKeepers.getEventLatencyOfPercentile(i))
 		}
+	}
 
-		reportCh <- fmt.Sprintf("id    endorse(ms) integrate(ms) order&commit(ms)")
-		for i, tk := range timeKeepers.transactions {
-			endorsementDuration := float64(tk.EndorsedTime-tk.ProposedTime) / float64(1e6)
-			if endorsementDuration < 0.0 {
-				endorsementDuration = 0.0
-			}
+	if config.DeliverType != DeliverTypeFiltered {
+		blockKeepers.report()
+	}
 
-			integrationDuration := float64(tk.BroadcastTime-tk.EndorsedTime) / float64(1e6)
-			if integrationDuration < 0.0 {
-				integrationDuration = 0.0
-			}
+	if config.Mode == ModeDirect {
+		mismatchKeepers.report()
+	}
 
-			orderingDuration := float64(tk.ObservedTime-tk.BroadcastTime) / float64(1e6)
-			if orderingDuration < 0.0 {
-				orderingDuration = 0.0
-			}
+	reportIdentities()
+	reportFaults(startTime.Add(duration))
+	reportEffectiveConfig()
 
-			reportCh <- fmt.Sprintf("%-5d %11.2f %13.2f %16.2f",
-				config.TxIDStart+i,
-				endorsementDuration,
-				integrationDuration,
-				orderingDuration,
-			)
+	reportCh <- fmt.Sprintf("id    endorse(ms) integrate(ms) order&commit(ms)")
+	for i, tk := range timeKeepers.transactions {
+		endorsementDuration := float64(tk.EndorsedTime-tk.ProposedTime) / float64(1e6)
+		if endorsementDuration < 0.0 {
+			endorsementDuration = 0.0
 		}
 
-		// Closing 'doneCh', a channel which is never sent an element, is a common technique to notify ending in Golang
-		// More information: https://go101.org/article/channel-use-cases.html#check-closed-status
-		close(doneCh)
+		integrationDuration := float64(tk.BroadcastTime-tk.EndorsedTime) / float64(1e6)
+		if integrationDuration < 0.0 {
+			integrationDuration = 0.0
+		}
 
-		// Wait for WriteLogToFile() to return
-		printWG.Wait()
+		orderingDuration := float64(tk.ObservedTime-tk.BroadcastTime) / float64(1e6)
+		if orderingDuration < 0.0 {
+			orderingDuration = 0.0
+		}
+
+		reportCh <- fmt.Sprintf("%-5d %11.2f %13.2f %16.2f",
+			config.TxIDStart+i,
+			endorsementDuration,
+			integrationDuration,
+			orderingDuration,
+		)
 	}
+
+	if len(unobserved) > 0 {
+		reportCh <- fmt.Sprintf("Unobserved Transactions:")
+		reportCh <- fmt.Sprintf("id    last-stage txid")
+		for _, tx := range unobserved {
+			reportCh <- fmt.Sprintf("%-5d %-10s %s", config.TxIDStart+tx.ID, tx.LastStage, tx.Txid)
+		}
+	}
+
+	// Closing 'doneCh', a channel which is never sent an element, is a common technique to notify ending in Golang
+	// More information: https://go101.org/article/channel-use-cases.html#check-closed-status
+	close(doneCh)
+
+	// Wait for WriteLogToFile() to return
+	printWG.Wait()
 }
 
 // End2End executes end-to-end benchmark on HLF
@@ -226,6 +303,9 @@ func WaitObserverEnd(startTime time.Time, printWG *sync.WaitGroup) {
 func End2End() {
 	initChannels()
 	initTimeKeepers()
+	initBlockKeepers()
+	initMismatchKeepers()
+	initFaultKeepers()
 
 	printWG := &sync.WaitGroup{}
 	go WriteLogToFile(printWG)
@@ -239,11 +319,14 @@ func End2End() {
 
 	integrators.StartAsync()
 	broadcasters.StartAsync()
-	observer.StartAsync()
 	initiator.StartSync() // Block until all raw transactions are ready
 	signer.StartSync()    // Block until all transactions are signed
 
+	// Start observing right before sending so that the idle timeout
+	// does not count the time spent on generating and signing
 	startTime := time.Now()
+	observer.StartAsync()
+	faultKeepers.start()
 	proposers.StartAsync()
 
 	WaitObserverEnd(startTime, printWG)
@@ -0,0 +1,196 @@
+package infra
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/osdi23p228/tape/pkg/mock"
+	log "github.com/sirupsen/logrus"
+)
+
+const mockConfigTemplate = `
+endorsers:
+  - address: %[1]s
+    mspid: %[3]s
+    tlsCACert: tlsca.pem
+  - address: %[2]s
+    mspid: %[4]s
+    tlsCACert: tlsca.pem
+committer:
+  address: %[1]s
+  tlsCACert: tlsca.pem
+orderer:
+  address: %[5]s
+  tlsCACert: tlsca.pem
+channel: mychannel
+chaincode: basic
+mspid: Org1MSP
+privateKey: client_sk
+signCert: client.pem
+e2e: true
+rate: 0
+burst: 1000
+txNum: 50
+idleTime: 10
+connNum: 2
+clientPerConnNum: 2
+integratorNum: 2
+broadcasterNum: 2
+seed: 1
+logPath: log.txt
+reportPath: report.txt
+`
+
+// runWithMockNetwork starts a mock network over TLS, and runs the whole pipeline against it
+// with the config above followed by the extra YAML
+func runWithMockNetwork(t *testing.T, extra string) (*Config, *mock.Network) {
+	network, err := mock.StartNetwork([]string{"127.0.0.1:0", "127.0.0.1:0"}, "127.0.0.1:0", mock.Options{
+		BlockSize:    8,
+		BlockTimeout: 50 * time.Millisecond,
+		TLS:          true,
+	})
+	if err != nil {
+		t.Fatalf("Fail to start mock network: %v", err)
+	}
+	t.Cleanup(network.Stop)
+
+	// The workload and the log files are written to the working directory
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	cert, key, err := mock.NewCertificate("client", nil)
+	if err != nil {
+		t.Fatalf("Fail to create client identity: %v", err)
+	}
+	raw := fmt.Sprintf(mockConfigTemplate,
+		network.Peers[0].Address(),
+		network.Peers[1].Address(),
+		network.Peers[0].MSPID,
+		network.Peers[1].MSPID,
+		network.Orderer.Address(),
+	) + extra
+	files := map[string][]byte{
+		"client.pem":  cert,
+		"client_sk":   key,
+		"tlsca.pem":   network.TLSCACert,
+		"config.yaml": []byte(raw),
+	}
+	for name, content := range files {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), content, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c, err := LoadConfigFromFile("config.yaml")
+	if err != nil {
+		t.Fatalf("Fail to load config: %v", err)
+	}
+
+	Metric = NewMetricInstance()
+	Process(c, log.New())
+
+	return c, network
+}
+
+// TestEnd2EndWithMockNetwork expects every transaction to be endorsed by both peers and committed
+func TestEnd2EndWithMockNetwork(t *testing.T) {
+	c, network := runWithMockNetwork(t, "txType: put\n")
+
+	if valid, abort := Metric.Count(); valid != int32(c.TxNum) || abort != 0 {
+		t.Fatalf("Expect %d valid transactions, got %d valid and %d aborted", c.TxNum, valid, abort)
+	}
+	if mismatch := len(mismatchKeepers.mismatches); mismatch != 0 {
+		t.Fatalf("Expect no mismatched endorsements, got %d", mismatch)
+	}
+	if height := network.Height(); height < 2 {
+		t.Fatalf("Expect blocks to be cut, got height %d", height)
+	}
+}
+
+// TestFaultsWithMockNetwork broadcasts every envelope twice and corrupts some of them,
+// expecting the corrupted ones to be rejected and the duplicated copies to be invalidated
+func TestFaultsWithMockNetwork(t *testing.T) {
+	c, _ := runWithMockNetwork(t, `
+txType: put
+faults:
+  - type: duplicateTxid
+  - type: badSignature
+    rate: 0.2
+`)
+
+	duplicate, badSignature := faultKeepers.faults[0], faultKeepers.faults[1]
+	if len(duplicate.hit) != c.TxNum {
+		t.Fatalf("Expect %d duplicated transactions, got %d", c.TxNum, len(duplicate.hit))
+	}
+	if valid, abort := Metric.Count(); abort != int32(len(badSignature.hit)) || valid+abort != int32(c.TxNum) {
+		t.Fatalf("Expect %d aborted transactions out of %d, got %d valid and %d aborted",
+			len(badSignature.hit), c.TxNum, valid, abort)
+	}
+
+	for txid := range duplicate.hit {
+		reactions := faultKeepers.reactions[txid]
+		expected := []string{"VALID", "DUPLICATE_TXID"}
+		if badSignature.hit[txid] {
+			expected = []string{"FORBIDDEN", "FORBIDDEN"}
+		}
+		if fmt.Sprint(reactions) != fmt.Sprint(expected) {
+			t.Fatalf("Expect reactions %v to transaction %s, got %v", expected, txid, reactions)
+		}
+	}
+}
+
+// TestTemplateWithMockNetwork expects the operations to be rendered and picked by weight
+func TestTemplateWithMockNetwork(t *testing.T) {
+	c, _ := runWithMockNetwork(t, `
+operations:
+  - function: Transfer
+    args: ['{{pick accounts zipf}}', '{{pick accounts uniform}}', '{{randInt 1 100}}']
+    weight: 3
+  - function: Create
+    args: ['{{uuid}}', 'tx-{{seq}}', '{{randString 8}}', '{{now}}']
+    transient:
+      secret: '{{randString 16}}'
+lists:
+  accounts:
+    values: [alice, bob, carol]
+`)
+
+	if valid, abort := Metric.Count(); valid != int32(c.TxNum) || abort != 0 {
+		t.Fatalf("Expect %d valid transactions, got %d valid and %d aborted", c.TxNum, valid, abort)
+	}
+
+	raw, err := ioutil.ReadFile(transactionFilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	functions := make(map[string]int)
+	for i, line := range strings.Split(strings.TrimSpace(string(raw)), "\n") {
+		fields := strings.Fields(line)
+		switch fields[1] {
+		case "Transfer":
+			if len(fields) != 5 || !strings.Contains("alice bob carol", fields[2]) {
+				t.Fatalf("Expect a transfer between the accounts, got %s", line)
+			}
+		case "Create":
+			if len(fields) != 6 || fields[3] != fmt.Sprintf("tx-%d", i) {
+				t.Fatalf("Expect a creation of transaction %d, got %s", i, line)
+			}
+		}
+		functions[fields[1]]++
+	}
+	if functions["Transfer"] <= functions["Create"] || functions["Create"] == 0 {
+		t.Fatalf("Expect more transfers than creations, got %v", functions)
+	}
+}
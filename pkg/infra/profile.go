@@ -0,0 +1,263 @@
+package infra
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// ConnectionProfile is the common connection profile shared by the Fabric SDKs, in YAML or JSON.
+// Only the parts locating the nodes of a channel are used
+type ConnectionProfile struct {
+	Client struct {
+		Organization string `yaml:"organization"` // organization of the client
+	} `yaml:"client"`
+	Channels      map[string]ProfileChannel      `yaml:"channels"`
+	Organizations map[string]ProfileOrganization `yaml:"organizations"`
+	Peers         map[string]ProfileNode         `yaml:"peers"`
+	Orderers      map[string]ProfileNode         `yaml:"orderers"`
+
+	dir string // folder of the profile, which relative paths are resolved against
+}
+
+type ProfileChannel struct {
+	Orderers []string                    `yaml:"orderers"`
+	Peers    map[string]ProfilePeerRoles `yaml:"peers"`
+}
+
+// ProfilePeerRoles describes what a peer of a channel is used for, where all roles are true by default
+type ProfilePeerRoles struct {
+	EndorsingPeer *bool `yaml:"endorsingPeer"`
+	EventSource   *bool `yaml:"eventSource"`
+}
+
+type ProfileOrganization struct {
+	MSPID    string   `yaml:"mspid"`
+	Peers    []string `yaml:"peers"`
+	Orderers []string `yaml:"orderers"`
+}
+
+type ProfileNode struct {
+	URL        string `yaml:"url"` // e.g. "grpcs://peer0.org1.example.com:7051"
+	TLSCACerts struct {
+		Path string `yaml:"path"` // file of the TLS root certificates
+		PEM  string `yaml:"pem"`  // inline TLS root certificates
+	} `yaml:"tlsCACerts"`
+	GRPCOptions map[string]interface{} `yaml:"grpcOptions"`
+}
+
+// LoadConnectionProfile loads the connection profile from a YAML or JSON file
+func LoadConnectionProfile(filename string) (*ConnectionProfile, error) {
+	raw, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to load %s", filename)
+	}
+
+	// JSON is a subset of YAML
+	profile := &ConnectionProfile{}
+	if err = yaml.Unmarshal(raw, profile); err != nil {
+		return nil, errors.Wrapf(err, "fail to unmarshal %s", filename)
+	}
+	profile.dir = filepath.Dir(filename)
+
+	return profile, nil
+}
+
+// loadConnectionProfile fills the nodes, the channel and the client's MSP ID which are
+// not provided in the configuration file with the ones in the connection profile
+func (c *Config) loadConnectionProfile() error {
+	if c.ConnectionProfile == "" {
+		return nil
+	}
+
+	profile, err := LoadConnectionProfile(c.ConnectionProfile)
+	if err != nil {
+		return errors.Wrap(err, "fail to load connection profile")
+	}
+
+	if err = c.importConnectionProfile(profile); err != nil {
+		return errors.Wrapf(err, "fail to import connection profile %s", c.ConnectionProfile)
+	}
+	return nil
+}
+
+func (c *Config) importConnectionProfile(profile *ConnectionProfile) error {
+	if c.Channel == "" {
+		if len(profile.Channels) != 1 {
+			return errors.Errorf("channel is not provided and the profile defines %d channels", len(profile.Channels))
+		}
+		for name := range profile.Channels {
+			c.Channel = name
+		}
+	}
+
+	if c.MSPID == "" && profile.Client.Organization != "" {
+		org, ok := profile.Organizations[profile.Client.Organization]
+		if !ok {
+			return errors.Errorf("organization %s of the client is not found", profile.Client.Organization)
+		}
+		c.MSPID = org.MSPID
+	}
+
+	endorsers, committer, err := profile.getChannelPeers(c.Channel)
+	if err != nil {
+		return err
+	}
+
+	if len(c.Endorsers) == 0 {
+		c.Endorsers = endorsers
+		for _, endorser := range c.Endorsers {
+			fmt.Printf("Imported endorser %s of %s\n", endorser.Address, endorser.MSPID)
+		}
+	}
+
+	if c.Committer.Address == "" {
+		c.Committer = committer
+		fmt.Printf("Imported committer %s of %s\n", c.Committer.Address, c.Committer.MSPID)
+	}
+	if c.Mode == ModeGateway && c.Gateway.Address == "" {
+		c.Gateway = committer
+	}
+	if c.Discovery.Enabled && c.Discovery.Peer.Address == "" {
+		c.Discovery.Peer = committer
+	}
+
+	if c.Orderer.Address == "" && c.Mode != ModeGateway {
+		c.Orderer, err = profile.getChannelOrderer(c.Channel)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Imported orderer %s of %s\n", c.Orderer.Address, c.Orderer.MSPID)
+	}
+
+	return nil
+}
+
+// getChannelPeers returns the endorsing peers of the channel sorted by name, and the event source,
+// preferably of the client's organization, to observe blocks from.
+// All peers in the profile are members of the channel if the profile does not define it
+func (p *ConnectionProfile) getChannelPeers(channel string) ([]Node, Node, error) {
+	roles := make(map[string]ProfilePeerRoles)
+	if ch, ok := p.Channels[channel]; ok {
+		roles = ch.Peers
+	} else if len(p.Channels) > 0 {
+		return nil, Node{}, errors.Errorf("channel %s is not found", channel)
+	} else {
+		for name := range p.Peers {
+			roles[name] = ProfilePeerRoles{}
+		}
+	}
+
+	var names []string
+	for name := range roles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	clientPeers := make(map[string]bool)
+	for _, name := range p.Organizations[p.Client.Organization].Peers {
+		clientPeers[name] = true
+	}
+
+	var endorsers []Node
+	var committer, fallback *Node
+	for _, name := range names {
+		node, err := p.getNode(name, p.Peers, func(org ProfileOrganization) []string { return org.Peers })
+		if err != nil {
+			return nil, Node{}, err
+		}
+
+		role := roles[name]
+		if role.EndorsingPeer == nil || *role.EndorsingPeer {
+			endorsers = append(endorsers, node)
+		}
+		if role.EventSource == nil || *role.EventSource {
+			n := node
+			if committer == nil && clientPeers[name] {
+				committer = &n
+			}
+			if fallback == nil {
+				fallback = &n
+			}
+		}
+	}
+
+	if len(endorsers) == 0 {
+		return nil, Node{}, errors.Errorf("no endorsing peer is found in channel %s", channel)
+	}
+	if committer == nil {
+		committer = fallback
+	}
+	if committer == nil {
+		return nil, Node{}, errors.Errorf("no event source is found in channel %s", channel)
+	}
+
+	return endorsers, *committer, nil
+}
+
+// getChannelOrderer returns the first orderer of the channel,
+// or the first one sorted by name if the channel does not list its orderers
+func (p *ConnectionProfile) getChannelOrderer(channel string) (Node, error) {
+	names := p.Channels[channel].Orderers
+	if len(names) == 0 {
+		for name := range p.Orderers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	if len(names) == 0 {
+		return Node{}, errors.Errorf("no orderer is found in channel %s", channel)
+	}
+
+	return p.getNode(names[0], p.Orderers, func(org ProfileOrganization) []string { return org.Orderers })
+}
+
+// getNode converts the peer or orderer with the name into a node, whose MSP ID is the one
+// of the organization owning it
+func (p *ConnectionProfile) getNode(name string, nodes map[string]ProfileNode, members func(ProfileOrganization) []string) (Node, error) {
+	pn, ok := nodes[name]
+	if !ok {
+		return Node{}, errors.Errorf("node %s is not defined", name)
+	}
+	if pn.URL == "" {
+		return Node{}, errors.Errorf("url of node %s is not provided", name)
+	}
+
+	node := Node{
+		Address: pn.URL,
+	}
+	if i := strings.Index(pn.URL, "://"); i >= 0 {
+		node.Address = pn.URL[i+len("://"):]
+	}
+
+	for _, org := range p.Organizations {
+		for _, member := range members(org) {
+			if member == name {
+				node.MSPID = org.MSPID
+			}
+		}
+	}
+
+	if !strings.HasPrefix(pn.URL, "grpc://") {
+		switch {
+		case pn.TLSCACerts.PEM != "":
+			node.TLSCACertByte = []byte(pn.TLSCACerts.PEM)
+		case pn.TLSCACerts.Path != "":
+			node.TLSCACert = pn.TLSCACerts.Path
+			if !filepath.IsAbs(node.TLSCACert) {
+				node.TLSCACert = filepath.Join(p.dir, node.TLSCACert)
+			}
+		}
+	}
+
+	if override, ok := pn.GRPCOptions["ssl-target-name-override"].(string); ok {
+		node.ServerNameOverride = override
+	}
+
+	return node, nil
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/golang/protobuf/proto"
 	"github.com/osdi23p228/fabric-protos-go/common"
+	"github.com/osdi23p228/fabric-protos-go/gateway"
 	"github.com/osdi23p228/fabric-protos-go/orderer"
 	"github.com/osdi23p228/fabric-protos-go/peer"
 	"github.com/osdi23p228/fabric/core/ledger/kvledger/txmgmt/rwsetutil"
@@ -25,8 +26,9 @@ func getRandomNonce() ([]byte, error) {
 	return key, nil
 }
 
-// CreateProposal creates an unsigned proposal based on the given information and returns a proposal and its transaction id
-func CreateProposal(txid string, channel, ccname, version string, args []string) (*peer.Proposal, string, error) {
+// CreateProposal creates an unsigned proposal of the identity based on the given information and returns a proposal and its transaction id.
+// The transient data, if any, is passed to the chaincode without being recorded in the transaction
+func CreateProposal(identity *Crypto, txid string, channel, ccname, version string, args []string, transient map[string][]byte) (*peer.Proposal, string, error) {
 	// convert the argument list to a byte list
 	var argsByte [][]byte
 	for _, arg := range args {
@@ -41,15 +43,14 @@ func CreateProposal(txid string, channel, ccname, version string, args []string)
 	}
 	invocation := &peer.ChaincodeInvocationSpec{ChaincodeSpec: spec}
 
-	// use the client's identity provided in the configuration file
-	creator, err := config.Identity.Serialize()
+	creator, err := identity.Serialize()
 	if err != nil {
 		return nil, "", err
 	}
 
 	if txid == "" {
 		// if transaction id is not provided, let the protoutil decides the ID
-		prop, txid, err := protoutil.CreateChaincodeProposal(common.HeaderType_ENDORSER_TRANSACTION, channel, invocation, creator)
+		prop, txid, err := protoutil.CreateChaincodeProposalWithTransient(common.HeaderType_ENDORSER_TRANSACTION, channel, invocation, creator, transient)
 		if err != nil {
 			return nil, "", err
 		}
@@ -58,7 +59,7 @@ func CreateProposal(txid string, channel, ccname, version string, args []string)
 		// To use a customized ID, we MUST disable txid check in
 		// core/endorser/msgvalidation.go:Validate and protoutil/proputils.go:ComputeTxID (v2)
 		nonce, err := getRandomNonce()
-		prop, txid, err := protoutil.CreateChaincodeProposalWithTxIDNonceAndTransient(txid, common.HeaderType_ENDORSER_TRANSACTION, channel, invocation, nonce, creator, nil)
+		prop, txid, err := protoutil.CreateChaincodeProposalWithTxIDNonceAndTransient(txid, common.HeaderType_ENDORSER_TRANSACTION, channel, invocation, nonce, creator, transient)
 		if err != nil {
 			return nil, "", err
 		}
@@ -66,14 +67,14 @@ func CreateProposal(txid string, channel, ccname, version string, args []string)
 	}
 }
 
-// SignProposal signs an unsigned proposal and attach the signature to the signed proposal
-func SignProposal(prop *peer.Proposal) (*peer.SignedProposal, error) {
+// SignProposal signs an unsigned proposal with the identity and attach the signature to the signed proposal
+func SignProposal(identity *Crypto, prop *peer.Proposal) (*peer.SignedProposal, error) {
 	proposalBytes, err := proto.Marshal(prop)
 	if err != nil {
 		return nil, err
 	}
 
-	signature, err := config.Identity.Sign(proposalBytes)
+	signature, err := identity.Sign(proposalBytes)
 	if err != nil {
 		return nil, err
 	}
@@ -85,8 +86,25 @@ func SignProposal(prop *peer.Proposal) (*peer.SignedProposal, error) {
 	return signedProposal, nil
 }
 
-// CreateSignedTx extract response, then signs and generates an envelope
-func CreateSignedTx(proposal *peer.Proposal, responses []*peer.ProposalResponse) (*common.Envelope, error) {
+// CreateSignedTx extract response, then signs with the identity and generates an envelope
+// getProposalTxid returns the txid in the header of the signed proposal
+func getProposalTxid(signedProposal *peer.SignedProposal) (string, error) {
+	proposal, err := protoutil.UnmarshalProposal(signedProposal.ProposalBytes)
+	if err != nil {
+		return "", err
+	}
+	header, err := protoutil.UnmarshalHeader(proposal.Header)
+	if err != nil {
+		return "", err
+	}
+	channelHeader, err := protoutil.UnmarshalChannelHeader(header.ChannelHeader)
+	if err != nil {
+		return "", err
+	}
+	return channelHeader.TxId, nil
+}
+
+func CreateSignedTx(identity *Crypto, proposal *peer.Proposal, responses []*peer.ProposalResponse) (*common.Envelope, error) {
 	if len(responses) == 0 {
 		return nil, errors.Errorf("Fail to find any response")
 	}
@@ -95,7 +113,7 @@ func CreateSignedTx(proposal *peer.Proposal, responses []*peer.ProposalResponse)
 		mustPrintTXRWSet(responses)
 	}
 
-	header, err := getHeader(proposal.Header)
+	header, err := getHeader(identity, proposal.Header)
 	if err != nil {
 		return nil, err
 	}
@@ -115,9 +133,10 @@ func CreateSignedTx(proposal *peer.Proposal, responses []*peer.ProposalResponse)
 		return nil, err
 	}
 
-	return generateEnvelope(payload)
+	return generateEnvelope(identity, payload)
 }
 
+// CreateSignedDeliverNewestEnv creates a signed deliver envelope seeking from the newest block
 func CreateSignedDeliverNewestEnv() (*common.Envelope, error) {
 	start := &orderer.SeekPosition{
 		Type: &orderer.SeekPosition_Newest{
@@ -125,6 +144,25 @@ func CreateSignedDeliverNewestEnv() (*common.Envelope, error) {
 		},
 	}
 
+	return CreateSignedDeliverEnv(start)
+}
+
+// CreateSignedDeliverSpecifiedEnv creates a signed deliver envelope seeking from the given block number
+func CreateSignedDeliverSpecifiedEnv(number uint64) (*common.Envelope, error) {
+	start := &orderer.SeekPosition{
+		Type: &orderer.SeekPosition_Specified{
+			Specified: &orderer.SeekSpecified{
+				Number: number,
+			},
+		},
+	}
+
+	return CreateSignedDeliverEnv(start)
+}
+
+// CreateSignedDeliverEnv creates a signed deliver envelope seeking from the start position
+// and blocking until new blocks are ready
+func CreateSignedDeliverEnv(start *orderer.SeekPosition) (*common.Envelope, error) {
 	stop := &orderer.SeekPosition{
 		Type: &orderer.SeekPosition_Specified{
 			Specified: &orderer.SeekSpecified{
@@ -149,14 +187,77 @@ func CreateSignedDeliverNewestEnv() (*common.Envelope, error) {
 	)
 }
 
-func getHeader(headerBytes []byte) (*common.Header, error) {
+// CreateSignedSeekNewestEnv creates a signed deliver envelope asking for the newest block only,
+// which tells whether the client is allowed to read the channel
+func CreateSignedSeekNewestEnv() (*common.Envelope, error) {
+	newest := &orderer.SeekPosition{
+		Type: &orderer.SeekPosition_Newest{
+			Newest: &orderer.SeekNewest{},
+		},
+	}
+
+	seekInfo := &orderer.SeekInfo{
+		Start:    newest,
+		Stop:     newest,
+		Behavior: orderer.SeekInfo_FAIL_IF_NOT_READY,
+	}
+
+	return protoutil.CreateSignedEnvelope(
+		common.HeaderType_DELIVER_SEEK_INFO,
+		config.Channel,
+		config.Identity,
+		seekInfo,
+		0,
+		0,
+	)
+}
+
+// SignPreparedTransaction signs the prepared transaction returned by the gateway with the identity
+func SignPreparedTransaction(identity *Crypto, envelope *common.Envelope) error {
+	signature, err := identity.Sign(envelope.Payload)
+	if err != nil {
+		return err
+	}
+	envelope.Signature = signature
+	return nil
+}
+
+// CreateSignedCommitStatusRequest creates a signed request asking the gateway for the commit status of a transaction
+func CreateSignedCommitStatusRequest(txid string) (*gateway.SignedCommitStatusRequest, error) {
+	creator, err := config.Identity.Serialize()
+	if err != nil {
+		return nil, err
+	}
+
+	request := &gateway.CommitStatusRequest{
+		TransactionId: txid,
+		ChannelId:     config.Channel,
+		Identity:      creator,
+	}
+	requestBytes, err := proto.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := config.Identity.Sign(requestBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &gateway.SignedCommitStatusRequest{
+		Request:   requestBytes,
+		Signature: signature,
+	}, nil
+}
+
+func getHeader(identity *Crypto, headerBytes []byte) (*common.Header, error) {
 	header := &common.Header{}
 	err := proto.Unmarshal(headerBytes, header)
 	if err != nil {
 		return nil, errors.Wrap(err, "error unmarshaling Header")
 	}
 
-	err = checkHeaderSignerValidity(header)
+	err = checkHeaderSignerValidity(identity, header)
 	if err != nil {
 		return nil, err
 	}
@@ -166,8 +267,8 @@ func getHeader(headerBytes []byte) (*common.Header, error) {
 
 // checkHeaderSignerValidity check that the signer is the same
 // that is referenced in the header.
-func checkHeaderSignerValidity(header *common.Header) error {
-	identityBytes, err := config.Identity.Serialize()
+func checkHeaderSignerValidity(identity *Crypto, header *common.Header) error {
+	identityBytes, err := identity.Serialize()
 	if err != nil {
 		return err
 	}
@@ -341,13 +442,13 @@ func generatePayload(header *common.Header, tx *peer.Transaction) (*common.Paylo
 	return payload, nil
 }
 
-func generateEnvelope(payload *common.Payload) (*common.Envelope, error) {
+func generateEnvelope(identity *Crypto, payload *common.Payload) (*common.Envelope, error) {
 	payloadBytes, err := protoutil.GetBytesPayload(payload)
 	if err != nil {
 		return nil, err
 	}
 
-	signature, err := config.Identity.Sign(payloadBytes)
+	signature, err := identity.Sign(payloadBytes)
 	if err != nil {
 		return nil, err
 	}
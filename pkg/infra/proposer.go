@@ -4,7 +4,11 @@ import (
 	"context"
 	"time"
 
+	"github.com/osdi23p228/fabric-protos-go/gateway"
 	"github.com/osdi23p228/fabric-protos-go/peer"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type Proposers struct {
@@ -18,28 +22,63 @@ func NewProposers(inChs []chan *Element, outCh chan *Element) *Proposers {
 	tokenCh := make(chan struct{}, int(config.Burst))
 	expectTPS := float64(config.Rate) / float64(config.ConnNum*config.ClientPerConnNum)
 
+	// Create all connections first, so that a proposer can hedge through
+	// the connections to the other endorsers of the same organization
+	grpcClients := make([][]peer.EndorserClient, config.EndorserNum)
+	gatewayClients := make([][]gateway.GatewayClient, config.EndorserNum)
+	for i, endorser := range config.Endorsers {
+		grpcClients[i] = make([]peer.EndorserClient, config.ConnNum)
+		gatewayClients[i] = make([]gateway.GatewayClient, config.ConnNum)
+
+		for j := 0; j < config.ConnNum; j++ {
+			var err error
+			if config.Mode == ModeGateway {
+				gatewayClients[i][j], err = CreateGatewayClient(endorser)
+			} else {
+				var client *redialEndorserClient
+				client, err = newRedialEndorserClient(endorser)
+				if err == nil {
+					grpcClients[i][j] = client
+					faultKeepers.addReconnector(endorser.Address, client.redial)
+				}
+			}
+			if err != nil {
+				logger.Fatalf("Fail to create No. %d connection for endorser %s: %v", j, endorser.Address, err)
+			}
+		}
+	}
+
 	for i, endorser := range config.Endorsers {
 		proposers[i] = make([][]*Proposer, config.ConnNum)
 
 		for j := 0; j < config.ConnNum; j++ {
 			proposers[i][j] = make([]*Proposer, config.ClientPerConnNum)
 
-			grpcClient, err := CreateEndorserClient(endorser)
-			if err != nil {
-				logger.Fatalf("Fail to create No. %d connection for endorser %s: %v", j, endorser.Address, err)
+			var hedgeClients []peer.EndorserClient
+			var hedgeAddresses []string
+			if config.HedgeDelay > 0 && endorser.MSPID != "" {
+				for h, other := range config.Endorsers {
+					if h != i && other.MSPID == endorser.MSPID && grpcClients[h][j] != nil {
+						hedgeClients = append(hedgeClients, grpcClients[h][j])
+						hedgeAddresses = append(hedgeAddresses, other.Address)
+					}
+				}
 			}
 
 			for k := 0; k < config.ClientPerConnNum; k++ {
 				proposers[i][j][k] = &Proposer{
-					endorserIndex: i,
-					connIndex:     j,
-					clientIndex:   k,
-					expectTPS:     expectTPS,
-					grpcClient:    grpcClient,
-					address:       endorser.Address,
-					inCh:          make(chan *Element, CH_MAX_CAPACITY),
-					outCh:         outCh,
-					tokenCh:       tokenCh,
+					endorserIndex:  i,
+					connIndex:      j,
+					clientIndex:    k,
+					expectTPS:      expectTPS,
+					grpcClient:     grpcClients[i][j],
+					gatewayClient:  gatewayClients[i][j],
+					hedgeClients:   hedgeClients,
+					hedgeAddresses: hedgeAddresses,
+					address:        endorser.Address,
+					inCh:           make(chan *Element, CH_MAX_CAPACITY),
+					outCh:          outCh,
+					tokenCh:        tokenCh,
 				}
 			}
 		}
@@ -78,7 +117,7 @@ func (ps *Proposers) generateTokens() {
 			ps.tokenCh <- struct{}{}
 		}
 	} else {
-		interval := 1e9 / float64(config.Rate) * float64(config.EndorserNum)
+		interval := 1e9 / float64(config.Rate) * endorsementsPerTx()
 		for {
 			time.Sleep(time.Duration(interval) * time.Nanosecond)
 			ps.tokenCh <- struct{}{}
@@ -102,15 +141,26 @@ func parseElementIndexes(e *Element) (int, int) {
 }
 
 type Proposer struct {
-	endorserIndex int
-	connIndex     int
-	clientIndex   int
-	expectTPS     float64
-	grpcClient    peer.EndorserClient
-	address       string
-	inCh          chan *Element
-	outCh         chan *Element
-	tokenCh       chan struct{}
+	endorserIndex  int
+	connIndex      int
+	clientIndex    int
+	expectTPS      float64
+	grpcClient     peer.EndorserClient
+	gatewayClient  gateway.GatewayClient // only used in 'gateway' mode
+	hedgeClients   []peer.EndorserClient // clients of the other endorsers of the same organization
+	hedgeAddresses []string
+	nextHedge      int // round-robin index of hedgeClients
+	address        string
+	inCh           chan *Element
+	outCh          chan *Element
+	tokenCh        chan struct{}
+}
+
+// endorseResult is the outcome of an endorsement request to an endorser
+type endorseResult struct {
+	resp    *peer.ProposalResponse
+	err     error
+	address string
 }
 
 func (p *Proposer) getToken() {
@@ -133,29 +183,202 @@ func (p *Proposer) Start() {
 
 			timeKeepers.keepProposedTime(element.Txid, p.endorserIndex, p.connIndex, p.clientIndex)
 
-			// send proposal
-			resp, err := p.grpcClient.ProcessProposal(context.Background(), element.SignedProposal)
-			if err != nil || resp.Response.Status < 200 || resp.Response.Status >= 400 {
-				if resp == nil {
-					logger.Errorf("Error processing proposal: %v, status: unknown, address: %s \n", err, p.address)
-				} else {
-					logger.Errorf("Error processing proposal: %v, status: %d, message: %s, address: %s \n", err, resp.Response.Status, resp.Response.Message, p.address)
-				}
+			if faultKeepers.inject(FaultDropProposal, p.address, element.Txid) != nil {
+				logger.Debugf("Drop proposal %s to %s", element.Txid, p.address)
+				p.dropProposal(element)
 				continue
 			}
 
-			element.lock.Lock()
-			element.Responses = append(element.Responses, resp)
-			if len(element.Responses) >= config.EndorserNum {
-				// Collect enough endorsement for this transaction
-				p.outCh <- element
+			if p.gatewayClient != nil {
+				p.endorseThroughGateway(element)
+				continue
+			}
 
-				timeKeepers.keepEndorsedTime(element.Txid, p.endorserIndex, p.connIndex, p.clientIndex)
+			// send proposal
+			result := p.endorse(element.SignedProposal)
+			if result.err != nil {
+				logger.Errorf("Error processing proposal: %v, address: %s \n", result.err, result.address)
+				p.finishEndorsement(element, nil)
+				continue
 			}
-			element.lock.Unlock()
+
+			p.finishEndorsement(element, result.resp)
 
 		case <-doneCh:
 			return
 		}
 	}
 }
+
+// dropProposal fails the endorsement request of the element as if it were lost
+func (p *Proposer) dropProposal(element *Element) {
+	if p.gatewayClient != nil {
+		Metric.AddAbort()
+		timeKeepers.keepAbortedTime(element.Txid)
+		return
+	}
+	p.finishEndorsement(element, nil)
+}
+
+// finishEndorsement records the outcome of one endorsement request of the element,
+// where a nil response means a failure. The element is aborted once all its requests
+// are finished without collecting enough endorsements
+func (p *Proposer) finishEndorsement(element *Element, resp *peer.ProposalResponse) {
+	element.lock.Lock()
+	element.Pending--
+	endorsed := false
+	// The responses are left to the integrator once the element is endorsed,
+	// so late responses, e.g. of hedged requests, are dropped
+	if resp != nil && !element.Endorsed {
+		element.Responses = append(element.Responses, resp)
+		if isEndorsementEnough(element.Responses) {
+			// Collect enough endorsement for this transaction
+			element.Endorsed = true
+			endorsed = true
+		}
+	}
+	aborted := element.Pending == 0 && !element.Endorsed
+	element.lock.Unlock()
+
+	if endorsed {
+		timeKeepers.keepEndorsedTime(element.Txid, p.endorserIndex, p.connIndex, p.clientIndex)
+		p.outCh <- element
+	}
+	if aborted {
+		Metric.AddAbort()
+		timeKeepers.keepAbortedTime(element.Txid)
+	}
+}
+
+// endorse sends the proposal to the endorser. If hedging is enabled and no response
+// arrives within the hedge delay, the proposal is also sent to another endorser of
+// the same organization, and the first successful response wins while the other request is cancelled
+func (p *Proposer) endorse(signedProposal *peer.SignedProposal) endorseResult {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	results := make(chan endorseResult, 2)
+	go func() {
+		resp, err := processProposal(ctx, p.grpcClient, signedProposal)
+		results <- endorseResult{resp: resp, err: err, address: p.address}
+	}()
+	pending := 1
+
+	var hedgeCh <-chan time.Time
+	if len(p.hedgeClients) > 0 {
+		hedgeTimer := time.NewTimer(time.Duration(config.HedgeDelay) * time.Millisecond)
+		defer hedgeTimer.Stop()
+		hedgeCh = hedgeTimer.C
+	}
+
+	var result endorseResult
+	for pending > 0 {
+		select {
+		case result = <-results:
+			pending--
+			if result.err == nil {
+				return result
+			}
+		case <-hedgeCh:
+			hedgeCh = nil
+			client, address := p.hedgeClients[p.nextHedge], p.hedgeAddresses[p.nextHedge]
+			p.nextHedge = (p.nextHedge + 1) % len(p.hedgeClients)
+
+			go func() {
+				resp, err := processProposal(ctx, client, signedProposal)
+				results <- endorseResult{resp: resp, err: err, address: address}
+			}()
+			pending++
+		}
+	}
+
+	return result
+}
+
+// processProposal sends the proposal with a deadline and retries on transient errors.
+// A response with an error status is returned as an error
+func processProposal(ctx context.Context, client peer.EndorserClient, signedProposal *peer.SignedProposal) (*peer.ProposalResponse, error) {
+	var resp *peer.ProposalResponse
+	err := callWithRetry(ctx, func(ctx context.Context) error {
+		var err error
+		resp, err = client.ProcessProposal(ctx, signedProposal)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Response.Status < 200 || resp.Response.Status >= 400 {
+		return nil, errors.Errorf("status: %d, message: %s", resp.Response.Status, resp.Response.Message)
+	}
+	return resp, nil
+}
+
+// callWithRetry calls the endorsement request with the configured deadline, and retries it
+// with exponential backoff as long as it fails with a transient gRPC error, until the parent context is cancelled
+func callWithRetry(parent context.Context, call func(ctx context.Context) error) error {
+	return retryTransient(parent, time.Duration(config.EndorseTimeout)*time.Millisecond, call)
+}
+
+// retryTransient calls the request with the deadline, or without any if it is 0, and retries it
+// as many times as an endorsement request as long as it fails with a transient gRPC error
+func retryTransient(parent context.Context, timeout time.Duration, call func(ctx context.Context) error) error {
+	backoff := time.Duration(config.EndorseRetryInterval) * time.Millisecond
+	for retry := 0; ; retry++ {
+		ctx, cancel := context.WithCancel(parent)
+		if timeout > 0 {
+			ctx, cancel = context.WithTimeout(parent, timeout)
+		}
+		err := call(ctx)
+		cancel()
+
+		if err == nil || retry >= config.EndorseRetry || !isTransientError(err) {
+			return err
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-parent.Done():
+			return err
+		case <-doneCh:
+			return err
+		}
+		backoff *= 2
+	}
+}
+
+// isTransientError returns true if the request may succeed when retried
+func isTransientError(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted:
+		return true
+	default:
+		return false
+	}
+}
+
+// endorseThroughGateway asks the gateway to collect enough endorsements for the element
+// and keeps the prepared transaction as the element's envelope
+func (p *Proposer) endorseThroughGateway(element *Element) {
+	var resp *gateway.EndorseResponse
+	err := callWithRetry(context.Background(), func(ctx context.Context) error {
+		var err error
+		resp, err = p.gatewayClient.Endorse(ctx, &gateway.EndorseRequest{
+			TransactionId:       element.Txid,
+			ChannelId:           config.Channel,
+			ProposedTransaction: element.SignedProposal,
+		})
+		return err
+	})
+	if err != nil {
+		logger.Errorf("Error endorsing through gateway: %v, address: %s \n", err, p.address)
+		Metric.AddAbort()
+		timeKeepers.keepAbortedTime(element.Txid)
+		return
+	}
+
+	element.Envelope = resp.PreparedTransaction
+	p.outCh <- element
+
+	timeKeepers.keepEndorsedTime(element.Txid, p.endorserIndex, p.connIndex, p.clientIndex)
+}
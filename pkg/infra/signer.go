@@ -32,11 +32,19 @@ func (s *Signer) StartSync() {
 				logger.Fatalf("Fail to sign transaction %s: %v", e.Txid, err)
 			}
 
-			// send the signed transactions to each endorser's proposers
-			startIndex := 0
-			endIndex := config.EndorserNum
-			for i := startIndex; i < endIndex; i++ {
-				s.outCh[i] <- e
+			// send the signed transactions to the proposers of each endorser,
+			// or only those satisfying the endorsement policy
+			if config.Policy != nil {
+				endorsers := config.Policy.SelectEndorsers()
+				e.Pending = len(endorsers)
+				for _, i := range endorsers {
+					s.outCh[i] <- e
+				}
+			} else {
+				e.Pending = config.EndorserNum
+				for i := 0; i < config.EndorserNum; i++ {
+					s.outCh[i] <- e
+				}
 			}
 
 		case <-doneCh:
@@ -45,9 +53,9 @@ func (s *Signer) StartSync() {
 	}
 }
 
-// SignElement signs a transaction with the assembler's identity
+// SignElement signs a transaction with the identity submitting it
 func (s *Signer) SignElement(e *Element) error {
-	signedProposal, err := SignProposal(e.Proposal)
+	signedProposal, err := SignProposal(e.Identity.Crypto, e.Proposal)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,333 @@
+package infra
+
+import (
+	"bufio"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Distributions of the values picked from a list
+const (
+	DistributionUniform = "uniform" // every value is equally likely
+	DistributionZipf    = "zipf"    // values at the front of the list are picked far more often
+)
+
+const (
+	accountListName = "accounts" // list of the accounts in the account file, unless defined in the config
+	zipfS           = 1.1        // skew of the zipf distribution, greater than 1
+)
+
+// OperationConfig is a chaincode invocation of the 'template' workload, whose arguments are Go templates, e.g.
+// "{{randInt 1 1000}}", which are rendered for each transaction
+type OperationConfig struct {
+	Function  string            `yaml:"function"`  // chaincode function name, also a template
+	Args      []string          `yaml:"args"`      // argument templates
+	Transient map[string]string `yaml:"transient"` // templates of the transient data by key
+	Chaincode string            `yaml:"chaincode"` // target chaincode, the configured one if empty
+	Weight    int               `yaml:"weight"`    // relative frequency among the operations, 1 by default
+}
+
+// ListConfig is a named list of values picked by the 'template' workload, given either inline or as a file
+type ListConfig struct {
+	Values []string `yaml:"values"` // values of the list
+	File   string   `yaml:"file"`   // file holding a value per line, used if no value is given
+}
+
+// templateWorkload picks an operation for each transaction by weight and renders its templates with generators:
+//
+//	{{seq}}                 index of the transaction, starting from 0
+//	{{uuid}}                random UUID
+//	{{randInt 1 1000}}      random integer within [1, 1000]
+//	{{randString 64}}       random string of 64 characters
+//	{{pick accounts zipf}}  value of the list 'accounts' in the 'uniform' or 'zipf' distribution
+//	{{now}}                 generation time in Unix milliseconds
+type templateWorkload struct {
+	operations []*operation
+	weights    int // sum of the weights of the operations
+	lists      map[string][]string
+	zipfs      map[string]*rand.Zipf // created on first use, after the seed is set
+	seq        int
+}
+
+// operation is an operation with its templates parsed
+type operation struct {
+	OperationConfig
+	function  *template.Template
+	args      []*template.Template
+	transient map[string]*template.Template
+	keys      []string // keys of the transient data in order, so that a seed reproduces the same values
+}
+
+// Init parses the templates of the operations, or of the arguments if no operation is provided,
+// and loads the lists they pick from
+func (w *templateWorkload) Init(c *Config) error {
+	var errs ConfigErrors
+
+	operations := c.Operations
+	if len(operations) == 0 {
+		if len(c.Args) == 0 {
+			return errors.Errorf("neither operations nor args is provided for tx type %s", TxTypeTemplate)
+		}
+		operations = []OperationConfig{{Function: c.Args[0], Args: c.Args[1:]}}
+	}
+
+	// Lists are referred to by name in templates, so they are parsed as functions returning their names
+	listNames := map[string]bool{accountListName: true}
+	for name := range c.Lists {
+		if _, ok := w.funcMap(nil)[name]; ok {
+			errs.addf("list %s is named after a generator", name)
+			continue
+		}
+		listNames[name] = true
+	}
+	funcs := w.funcMap(listNames)
+
+	referred := make(map[string]bool)
+	parseTemplate := func(i int, text string) *template.Template {
+		t, err := template.New(fmt.Sprintf("operation %d", i)).Funcs(funcs).Parse(text)
+		if err != nil {
+			errs.addf("operation %d: %v", i, err)
+			return nil
+		}
+		collectIdentifiers(t.Root, referred)
+		return t
+	}
+
+	for i, oc := range operations {
+		if oc.Function == "" {
+			errs.addf("operation %d: function is not provided", i)
+		}
+		if oc.Weight < 0 {
+			errs.addf("operation %d: weight %d is not a zero (1 by default) or positive number", i, oc.Weight)
+		} else if oc.Weight == 0 {
+			oc.Weight = 1
+		}
+
+		op := &operation{
+			OperationConfig: oc,
+			function:        parseTemplate(i, oc.Function),
+			transient:       make(map[string]*template.Template),
+		}
+		for _, arg := range oc.Args {
+			op.args = append(op.args, parseTemplate(i, arg))
+		}
+		for key, value := range oc.Transient {
+			op.transient[key] = parseTemplate(i, value)
+			op.keys = append(op.keys, key)
+		}
+		sort.Strings(op.keys)
+
+		w.operations = append(w.operations, op)
+		w.weights += op.Weight
+	}
+
+	w.lists = make(map[string][]string)
+	w.zipfs = make(map[string]*rand.Zipf)
+	for name := range listNames {
+		if !referred[name] {
+			continue
+		}
+
+		lc, ok := c.Lists[name]
+		if !ok && name == accountListName {
+			lc = ListConfig{File: accountFilePath}
+		}
+		values, err := lc.load()
+		if err != nil {
+			errs.addf("list %s: %v", name, err)
+			continue
+		}
+		if len(values) == 0 {
+			errs.addf("list %s is empty", name)
+		}
+		w.lists[name] = values
+	}
+
+	return errs.err()
+}
+
+func (w *templateWorkload) Next() (*Invocation, error) {
+	op := w.pickOperation()
+	defer func() { w.seq++ }()
+
+	function, err := render(op.function)
+	if err != nil {
+		return nil, err
+	}
+
+	invocation := &Invocation{
+		Function:  function,
+		Chaincode: op.Chaincode,
+	}
+	for _, t := range op.args {
+		arg, err := render(t)
+		if err != nil {
+			return nil, err
+		}
+		invocation.Args = append(invocation.Args, arg)
+	}
+	if len(op.transient) > 0 {
+		invocation.Transient = make(map[string][]byte)
+		for _, key := range op.keys {
+			value, err := render(op.transient[key])
+			if err != nil {
+				return nil, err
+			}
+			invocation.Transient[key] = []byte(value)
+		}
+	}
+	return invocation, nil
+}
+
+// pickOperation returns an operation with the probability proportional to its weight
+func (w *templateWorkload) pickOperation() *operation {
+	n := rand.Intn(w.weights)
+	for _, op := range w.operations {
+		if n < op.Weight {
+			return op
+		}
+		n -= op.Weight
+	}
+	return w.operations[len(w.operations)-1]
+}
+
+func render(t *template.Template) (string, error) {
+	b := &strings.Builder{}
+	if err := t.Execute(b, nil); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// funcMap returns the generators, along with the distributions and the lists as functions returning their names
+func (w *templateWorkload) funcMap(listNames map[string]bool) template.FuncMap {
+	funcs := template.FuncMap{
+		"seq": func() int {
+			return w.seq
+		},
+		"uuid": func() string {
+			b := make([]byte, 16)
+			rand.Read(b)
+			b[6] = b[6]&0x0f | 0x40 // version 4
+			b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+			return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+		},
+		"randInt": func(min, max int) (int, error) {
+			if min > max {
+				return 0, errors.Errorf("min %d is greater than max %d", min, max)
+			}
+			return min + rand.Intn(max-min+1), nil
+		},
+		"randString": func(n int) string {
+			return getName(n)
+		},
+		"pick": w.pick,
+		"now": func() string {
+			return strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10)
+		},
+		DistributionUniform: func() string { return DistributionUniform },
+		DistributionZipf:    func() string { return DistributionZipf },
+	}
+	for name := range listNames {
+		name := name
+		funcs[name] = func() string { return name }
+	}
+	return funcs
+}
+
+// pick returns a value of the list in the distribution
+func (w *templateWorkload) pick(list string, distribution string) (string, error) {
+	values, ok := w.lists[list]
+	if !ok || len(values) == 0 {
+		return "", errors.Errorf("list %s is empty", list)
+	}
+
+	if len(values) == 1 {
+		return values[0], nil
+	}
+
+	switch distribution {
+	case DistributionUniform:
+		return values[rand.Intn(len(values))], nil
+	case DistributionZipf:
+		zipf, ok := w.zipfs[list]
+		if !ok {
+			zipf = rand.NewZipf(rand.New(rand.NewSource(rand.Int63())), zipfS, 1, uint64(len(values)-1))
+			w.zipfs[list] = zipf
+		}
+		return values[zipf.Uint64()], nil
+	default:
+		return "", errors.Errorf("distribution %s is not one of ['%s', '%s']", distribution, DistributionUniform, DistributionZipf)
+	}
+}
+
+// load returns the values of the list
+func (lc ListConfig) load() ([]string, error) {
+	if len(lc.Values) > 0 || lc.File == "" {
+		return lc.Values, nil
+	}
+
+	f, err := os.Open(lc.File)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to open list file %s", lc.File)
+	}
+	defer f.Close()
+
+	var values []string
+	input := bufio.NewScanner(f)
+	for input.Scan() {
+		if line := strings.TrimSpace(input.Text()); line != "" {
+			values = append(values, line)
+		}
+	}
+	return values, input.Err()
+}
+
+// collectIdentifiers adds the names of the functions called in the template nodes to the set
+func collectIdentifiers(node parse.Node, names map[string]bool) {
+	switch node := node.(type) {
+	case *parse.ListNode:
+		if node == nil {
+			return
+		}
+		for _, n := range node.Nodes {
+			collectIdentifiers(n, names)
+		}
+	case *parse.ActionNode:
+		collectIdentifiers(node.Pipe, names)
+	case *parse.PipeNode:
+		if node == nil {
+			return
+		}
+		for _, cmd := range node.Cmds {
+			collectIdentifiers(cmd, names)
+		}
+	case *parse.CommandNode:
+		for _, arg := range node.Args {
+			collectIdentifiers(arg, names)
+		}
+	case *parse.IdentifierNode:
+		names[node.Ident] = true
+	case *parse.IfNode:
+		collectBranchIdentifiers(&node.BranchNode, names)
+	case *parse.RangeNode:
+		collectBranchIdentifiers(&node.BranchNode, names)
+	case *parse.WithNode:
+		collectBranchIdentifiers(&node.BranchNode, names)
+	}
+}
+
+func collectBranchIdentifiers(node *parse.BranchNode, names map[string]bool) {
+	collectIdentifiers(node.Pipe, names)
+	collectIdentifiers(node.List, names)
+	collectIdentifiers(node.ElseList, names)
+}
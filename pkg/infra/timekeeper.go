@@ -3,6 +3,7 @@ package infra
 import (
 	"fmt"
 	"sort"
+	"sync"
 	"time"
 
 	"github.com/osdi23p228/fabric-protos-go/peer"
@@ -17,14 +18,47 @@ type TimeKeepers struct {
 	endorseLatency      []int64
 	orderCommitLatency  []int64
 	totalLatency        []int64
+	eventLatency        []int64
 	commitLatencySorted []int64
+	eventLatencySorted  []int64
+	lock                sync.Mutex // guards the records, which are no longer updated once stopped
+	stopped             bool
 }
 
 type TimeKeeper struct {
 	ProposedTime  int64
 	EndorsedTime  int64
 	BroadcastTime int64
+	AbortedTime   int64 // when the transaction is aborted before being broadcast
 	ObservedTime  int64
+	EventTime     int64 // when the expected chaincode event is received
+	Valid         bool  // whether the observed transaction is valid
+	Identity      int   // index of the identity submitting the transaction
+}
+
+// lastStage returns the last stage the transaction has reached
+func (tk *TimeKeeper) lastStage() string {
+	switch {
+	case tk.ObservedTime != 0:
+		return "Observed"
+	case tk.AbortedTime != 0:
+		return "Aborted"
+	case tk.BroadcastTime != 0:
+		return "Broadcast"
+	case tk.EndorsedTime != 0:
+		return "Endorsed"
+	case tk.ProposedTime != 0:
+		return "Proposed"
+	default:
+		return "Created"
+	}
+}
+
+// UnobservedTransaction is a transaction never observed by the observer
+type UnobservedTransaction struct {
+	ID        int
+	Txid      string
+	LastStage string
 }
 
 func initTimeKeepers() {
@@ -33,7 +67,9 @@ func initTimeKeepers() {
 		endorseLatency:      make([]int64, config.TxNum),
 		orderCommitLatency:  make([]int64, config.TxNum),
 		totalLatency:        make([]int64, config.TxNum),
+		eventLatency:        make([]int64, config.TxNum),
 		commitLatencySorted: nil,
+		eventLatencySorted:  nil,
 	}
 	for i := range timeKeepers.transactions {
 		timeKeepers.transactions[i] = &TimeKeeper{}
@@ -46,6 +82,12 @@ func (tks *TimeKeepers) keepProposedTime(
 	connIndex int,
 	clientIndex int,
 ) {
+	tks.lock.Lock()
+	defer tks.lock.Unlock()
+	if tks.stopped {
+		return
+	}
+
 	proposedTime := time.Now().UnixNano()
 
 	id := txid2id[txid]
@@ -60,6 +102,12 @@ func (tks *TimeKeepers) keepEndorsedTime(
 	connIndex int,
 	clientIndex int,
 ) {
+	tks.lock.Lock()
+	defer tks.lock.Unlock()
+	if tks.stopped {
+		return
+	}
+
 	endorsedTime := time.Now().UnixNano()
 
 	id := txid2id[txid]
@@ -73,6 +121,12 @@ func (tks *TimeKeepers) keepBroadcastTime(
 	txid string,
 	broadcasterIndex int,
 ) {
+	tks.lock.Lock()
+	defer tks.lock.Unlock()
+	if tks.stopped {
+		return
+	}
+
 	broadcastTime := time.Now().UnixNano()
 
 	id := txid2id[txid]
@@ -81,18 +135,88 @@ func (tks *TimeKeepers) keepBroadcastTime(
 	timeKeepers.transactions[id].BroadcastTime = broadcastTime
 }
 
+func (tks *TimeKeepers) keepAbortedTime(
+	txid string,
+) {
+	tks.lock.Lock()
+	defer tks.lock.Unlock()
+	if tks.stopped {
+		return
+	}
+
+	abortedTime := time.Now().UnixNano()
+
+	id := txid2id[txid]
+	logCh <- fmt.Sprintf("%-10s %d %4d %s", "Aborted", abortedTime, id, txid)
+
+	timeKeepers.transactions[id].AbortedTime = abortedTime
+}
+
+// keepObservedTime records when the transaction is observed. It returns false without recording anything
+// if the transaction has been observed or aborted, or the records are stopped
 func (tks *TimeKeepers) keepObservedTime(
 	txid string,
 	validationCode peer.TxValidationCode,
-) {
-	observedTime := time.Now().UnixNano()
+) bool {
+	tks.lock.Lock()
+	defer tks.lock.Unlock()
 
 	id := txid2id[txid]
+	tk := timeKeepers.transactions[id]
+	if tks.stopped || tk.ObservedTime != 0 || tk.AbortedTime != 0 {
+		return false
+	}
+
+	observedTime := time.Now().UnixNano()
 	logCh <- fmt.Sprintf("%-10s %d %4d %s %s", "Observed", observedTime, id, txid, validationCode)
 
 	timeKeepers.transactions[id].ObservedTime = observedTime
+	timeKeepers.transactions[id].Valid = validationCode == peer.TxValidationCode_VALID
 	timeKeepers.totalLatency[id] = observedTime - timeKeepers.transactions[id].ProposedTime
 	timeKeepers.orderCommitLatency[id] = observedTime - timeKeepers.transactions[id].BroadcastTime
+	return true
+}
+
+// stop stops updating the records, so that they can be reported while the stages are still running
+func (tks *TimeKeepers) stop() {
+	tks.lock.Lock()
+	defer tks.lock.Unlock()
+
+	tks.stopped = true
+}
+
+// getValidAndAbortedNum returns the number of valid transactions, and the number of transactions
+// either aborted before broadcast or observed as invalid
+func (tks *TimeKeepers) getValidAndAbortedNum() (int, int) {
+	valid, aborted := 0, 0
+	for _, tk := range tks.transactions {
+		switch {
+		case tk.ObservedTime != 0 && tk.Valid:
+			valid++
+		case tk.ObservedTime != 0 || tk.AbortedTime != 0:
+			aborted++
+		}
+	}
+	return valid, aborted
+}
+
+func (tks *TimeKeepers) keepEventTime(
+	txid string,
+	eventName string,
+) {
+	tks.lock.Lock()
+	defer tks.lock.Unlock()
+	if tks.stopped {
+		return
+	}
+
+	eventTime := time.Now().UnixNano()
+
+	id := txid2id[txid]
+	logCh <- fmt.Sprintf("%-10s %d %4d %s %s", "Event", eventTime, id, txid, eventName)
+
+	timeKeepers.transactions[id].EventTime = eventTime
+	timeKeepers.eventLatency[id] = eventTime - timeKeepers.transactions[id].ProposedTime
 }
 
 func (tks *TimeKeepers) getAverageTotalLatency() float64 {
@@ -155,3 +279,85 @@ func (tks *TimeKeepers) sortCommitLatency() {
 		},
 	)
 }
+
+// getEventNum returns the number of transactions whose expected event is received
+func (tks *TimeKeepers) getEventNum() int {
+	num := 0
+	for _, tk := range tks.transactions {
+		if tk.EventTime != 0 {
+			num++
+		}
+	}
+	return num
+}
+
+// getAverageEventLatency only takes the transactions with events into account
+func (tks *TimeKeepers) getAverageEventLatency() float64 {
+	num := tks.getEventNum()
+	if num == 0 {
+		return 0
+	}
+
+	var result int64 = 0
+	for _, el := range tks.eventLatency {
+		result += el
+	}
+	return float64(result) / float64(num) / 1e9
+}
+
+func (tks *TimeKeepers) getEventLatencyOfPercentile(p int) float64 {
+	if tks.eventLatencySorted == nil {
+		tks.sortEventLatency()
+	}
+
+	if len(tks.eventLatencySorted) == 0 {
+		return 0
+	}
+
+	index := int(float64(p) / 100.0 * float64(len(tks.eventLatencySorted)))
+	if index < 0 {
+		index = 0
+	} else if index >= len(tks.eventLatencySorted) {
+		index = len(tks.eventLatencySorted) - 1
+	}
+
+	return float64(tks.eventLatencySorted[index]) / 1e9
+}
+
+// sortEventLatency sorts the event latency of the transactions with events
+func (tks *TimeKeepers) sortEventLatency() {
+	tks.eventLatencySorted = make([]int64, 0, len(tks.eventLatency))
+	for id, el := range tks.eventLatency {
+		if tks.transactions[id].EventTime != 0 {
+			tks.eventLatencySorted = append(tks.eventLatencySorted, el)
+		}
+	}
+	sort.Slice(
+		tks.eventLatencySorted,
+		func(i, j int) bool {
+			return tks.eventLatencySorted[i] < tks.eventLatencySorted[j]
+		},
+	)
+}
+
+// getUnobservedTransactions returns the transactions that are neither observed nor
+// aborted before broadcast, ordered by their id
+func (tks *TimeKeepers) getUnobservedTransactions() []UnobservedTransaction {
+	id2txid := make([]string, len(tks.transactions))
+	for txid, id := range txid2id {
+		id2txid[id] = txid
+	}
+
+	var result []UnobservedTransaction
+	for id, tk := range tks.transactions {
+		if tk.ObservedTime != 0 || tk.AbortedTime != 0 {
+			continue
+		}
+		result = append(result, UnobservedTransaction{
+			ID:        id,
+			Txid:      id2txid[id],
+			LastStage: tk.lastStage(),
+		})
+	}
+	return result
+}
@@ -0,0 +1,150 @@
+package infra
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	walletIdentityExtension = ".id"
+	walletIdentityType      = "X.509"
+)
+
+// walletIdentity is an X.509 identity stored in a Fabric SDK file-system wallet as "<label>.id"
+type walletIdentity struct {
+	Credentials struct {
+		Certificate string `json:"certificate"`
+		PrivateKey  string `json:"privateKey"`
+	} `json:"credentials"`
+	MSPID   string `json:"mspId"`
+	Type    string `json:"type"`
+	Version int    `json:"version"`
+}
+
+// loadCredentials returns the PEM-encoded private key and certificate of an identity and its MSP ID.
+// The sources are tried in the order of wallet, MSP folder and individual files
+func loadCredentials(cc CryptoConfig) ([]byte, []byte, string, error) {
+	// The private key stays in the HSM with the 'pkcs11' signer
+	needKey := cc.Signer != SignerPKCS11
+
+	switch {
+	case cc.Wallet != "":
+		return loadWalletCredentials(cc.Wallet, cc.WalletLabel, cc.MSPID)
+	case cc.MSPDir != "":
+		return loadMSPDirCredentials(cc.MSPDir, cc.MSPID, needKey)
+	default:
+		if !needKey {
+			return loadFileCredentials("", cc.SignCert, cc.MSPID)
+		}
+		return loadFileCredentials(cc.PrivKey, cc.SignCert, cc.MSPID)
+	}
+}
+
+// loadFileCredentials loads the private key and the certificate, where an empty key file is skipped
+func loadFileCredentials(keyFile, certFile, mspID string) ([]byte, []byte, string, error) {
+	var keyPEM []byte
+	if keyFile != "" {
+		var err error
+		keyPEM, err = ioutil.ReadFile(keyFile)
+		if err != nil {
+			return nil, nil, "", errors.Wrap(err, "fail to load private key")
+		}
+	}
+
+	certPEM, err := ioutil.ReadFile(certFile)
+	if err != nil {
+		return nil, nil, "", errors.Wrap(err, "fail to load certificate")
+	}
+
+	return keyPEM, certPEM, mspID, nil
+}
+
+// loadMSPDirCredentials loads the only private key in 'keystore' if needed and the only certificate in 'signcerts'
+func loadMSPDirCredentials(dir, mspID string, needKey bool) ([]byte, []byte, string, error) {
+	var keyFile string
+	if needKey {
+		var err error
+		keyFile, err = getOnlyFile(filepath.Join(dir, "keystore"))
+		if err != nil {
+			return nil, nil, "", err
+		}
+	}
+
+	certFile, err := getOnlyFile(filepath.Join(dir, "signcerts"))
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	return loadFileCredentials(keyFile, certFile, mspID)
+}
+
+// getOnlyFile returns the path of the only regular file in the directory
+func getOnlyFile(dir string) (string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return "", errors.Wrapf(err, "fail to read %s", dir)
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if entry.Mode().IsRegular() {
+			files = append(files, entry.Name())
+		}
+	}
+	sort.Strings(files)
+
+	switch len(files) {
+	case 0:
+		return "", errors.Errorf("no file is found in %s", dir)
+	case 1:
+		return filepath.Join(dir, files[0]), nil
+	default:
+		return "", errors.Errorf("more than one file is found in %s: %v", dir, files)
+	}
+}
+
+// loadWalletCredentials loads the identity with the label from a wallet.
+// The MSP ID in the wallet is used unless another one is specified
+func loadWalletCredentials(dir, label, mspID string) ([]byte, []byte, string, error) {
+	if label == "" {
+		return nil, nil, "", errors.Errorf("label of the identity in wallet %s is not provided", dir)
+	}
+
+	filename := filepath.Join(dir, label+walletIdentityExtension)
+	raw, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, nil, "", errors.Wrapf(err, "fail to load identity %s from wallet", label)
+	}
+
+	identity := &walletIdentity{}
+	if err = json.Unmarshal(raw, identity); err != nil {
+		return nil, nil, "", errors.Wrapf(err, "fail to unmarshal %s", filename)
+	}
+	if identity.Type != "" && identity.Type != walletIdentityType {
+		return nil, nil, "", errors.Errorf("identity %s of type %s is not supported", label, identity.Type)
+	}
+
+	if mspID == "" {
+		mspID = identity.MSPID
+	}
+
+	return []byte(identity.Credentials.PrivateKey), []byte(identity.Credentials.Certificate), mspID, nil
+}
+
+// getSecretFromEnv reads a secret, e.g. the password of an encrypted private key, from the environment variable
+func getSecretFromEnv(env string) ([]byte, error) {
+	if env == "" {
+		return nil, nil
+	}
+
+	secret, ok := os.LookupEnv(env)
+	if !ok {
+		return nil, errors.Errorf("environment variable %s is not set", env)
+	}
+	return []byte(secret), nil
+}
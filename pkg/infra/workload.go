@@ -2,11 +2,15 @@ package infra
 
 import (
 	"bufio"
+	"fmt"
 	"math/rand"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/pkg/errors"
 )
 
 const (
@@ -14,29 +18,102 @@ const (
 	transactionFilePath = "TRANSACTIONS.txt"
 )
 
+// Types of the generated transactions
+const (
+	TxTypePut      = "put"      // create new accounts, whose ids are written to the account file
+	TxTypeConflict = "conflict" // send payments between the accounts in the account file
+	TxTypeTemplate = "template" // invoke the operations, or the arguments, rendered from templates
+)
+
 var (
 	chs = []rune("qwertyuiopasdfghjklzxcvbnmQWERTYUIOPASDFGHJKLZXCVBNM1234567890!@#$%^&*()=")
+
+	workloads = make(map[string]func() Workload) // factories of the registered workloads by transaction type
 )
 
-type WorkloadGenerator struct {
-	ccArgsList [][]string
-	accounts   []string
+func init() {
+	RegisterWorkload(TxTypePut, func() Workload { return &putWorkload{} })
+	RegisterWorkload(TxTypeConflict, func() Workload { return &conflictWorkload{} })
+	RegisterWorkload(TxTypeTemplate, func() Workload { return &templateWorkload{} })
+}
+
+// Invocation is a chaincode invocation generated by a workload
+type Invocation struct {
+	Function  string
+	Args      []string
+	Transient map[string][]byte // private data passed to the chaincode, which is not recorded on the ledger
+	Chaincode string            // target chaincode, the configured one if empty
+}
+
+// ccArgs returns the function name followed by the arguments
+func (inv *Invocation) ccArgs() []string {
+	return append([]string{inv.Function}, inv.Args...)
+}
+
+// chaincode returns the name and version of the target chaincode. The configured version only applies
+// to the configured chaincode
+func (inv *Invocation) chaincode() (string, string) {
+	if inv.Chaincode == "" || inv.Chaincode == config.Chaincode {
+		return config.Chaincode, config.Version
+	}
+	return inv.Chaincode, ""
+}
+
+// Workload generates the invocations of all transactions in a run
+type Workload interface {
+	// Init prepares the workload with the config before any invocation is generated, e.g. loading the data it needs
+	Init(c *Config) error
+	// Next generates the invocation of the next transaction
+	Next() (*Invocation, error)
+}
+
+// WorkloadRecorder is implemented by workloads which keep a record of what they have generated,
+// e.g. the accounts to be created, once all invocations are generated
+type WorkloadRecorder interface {
+	Record() error
+}
+
+// RegisterWorkload makes the workload available as a transaction type. It is meant to be called from init functions
+// and panics if the type has been registered
+func RegisterWorkload(txType string, factory func() Workload) {
+	if _, ok := workloads[txType]; ok {
+		panic(fmt.Sprintf("workload %s is registered twice", txType))
+	}
+	workloads[txType] = factory
+}
+
+// registeredWorkloads returns the registered transaction types in order
+func registeredWorkloads() []string {
+	var txTypes []string
+	for txType := range workloads {
+		txTypes = append(txTypes, txType)
+	}
+	sort.Strings(txTypes)
+	return txTypes
 }
 
-func generateCCArgsList() [][]string {
+// generateInvocations generates the invocations of all transactions and writes them to the transaction file
+func generateInvocations() []*Invocation {
 	initSeed()
-	wg := NewWorkloadGenerator()
 
-	for i := 0; i < config.TxNum; i++ {
-		wg.ccArgsList[i] = wg.generateCCArgs()
+	invocations := make([]*Invocation, config.TxNum)
+	for i := range invocations {
+		invocation, err := config.workload.Next()
+		if err != nil {
+			logger.Fatalf("Fail to generate transaction %d of workload %s: %v", i, config.TxType, err)
+		}
+		invocations[i] = invocation
 	}
 
-	wg.mustWriteArgsToFile()
-	if config.TxType == "put" {
-		wg.mustWriteAccountsToFile()
+	mustWriteInvocationsToFile(invocations)
+	// Nothing generated in dry run reaches the ledger
+	if recorder, ok := config.workload.(WorkloadRecorder); ok && !config.DryRun {
+		if err := recorder.Record(); err != nil {
+			logger.Fatalf("Fail to record workload %s: %v", config.TxType, err)
+		}
 	}
 
-	return wg.ccArgsList
+	return invocations
 }
 
 func initSeed() {
@@ -47,140 +124,157 @@ func initSeed() {
 	}
 }
 
-func NewWorkloadGenerator() *WorkloadGenerator {
-	wg := &WorkloadGenerator{
-		ccArgsList: make([][]string, config.TxNum),
-	}
-
-	if config.TxType == "conflict" {
-		wg.mustLoadAccountsFromFile()
+func getName(n int) string {
+	b := make([]rune, n)
+	for i := range b {
+		b[i] = chs[rand.Intn(len(chs))]
 	}
-
-	return wg
+	return string(b)
 }
 
-func (wg *WorkloadGenerator) mustLoadAccountsFromFile() {
-	// try to load all accounts' id from file
-	if _, err := os.Stat(accountFilePath); os.IsNotExist(err) {
-		logger.Fatalf("Fail to find account file %s: %v\n", accountFilePath, err)
-	}
+func mustWriteInvocationsToFile(invocations []*Invocation) {
+	os.Remove(transactionFilePath)
 
-	af, err := os.Open(accountFilePath)
+	tf, err := os.Create(transactionFilePath)
 	if err != nil {
-		logger.Fatalf("Fail to open account file %s: %v\n", accountFilePath, err)
+		logger.Fatalf("Failed to create file %s: %v\n", transactionFilePath, err)
 	}
-	defer af.Close()
+	defer tf.Close()
 
-	input := bufio.NewScanner(af)
-	for input.Scan() {
-		accountID := input.Text()
-		wg.accounts = append(wg.accounts, accountID)
+	for i, invocation := range invocations {
+		tf.WriteString(strconv.Itoa(i) + " " + strings.Join(invocation.ccArgs(), " ") + "\n")
 	}
-	logger.Infof("Load %d accounts from %s", len(wg.accounts), accountFilePath)
 }
 
-func (wg *WorkloadGenerator) generateCCArgs() []string {
-	switch config.TxType {
-	case "put":
-		return wg.generateCCArgsPut()
-	case "conflict":
-		return wg.generateCCArgsConflict()
-	default:
-		return nil
-	}
+// putWorkload creates new accounts, whose ids are written to the account file
+type putWorkload struct {
+	accounts []string
 }
 
-func (wg *WorkloadGenerator) generateCCArgsPut() []string {
-	var result []string
+func (w *putWorkload) Init(c *Config) error {
+	return nil
+}
 
+func (w *putWorkload) Next() (*Invocation, error) {
 	id := getName(64) // generate a random name for customer
+	w.accounts = append(w.accounts, id)
+
+	return &Invocation{
+		Function: "CreateAccount",
+		Args: []string{
+			id,                // customer id
+			id,                // customer name
+			strconv.Itoa(1e9), // savings balance
+			strconv.Itoa(1e9), // checking balance
+		},
+	}, nil
+}
 
-	result = append(result, "CreateAccount")   // function name
-	result = append(result, id)                // customer id
-	result = append(result, id)                // customer name
-	result = append(result, strconv.Itoa(1e9)) // savings balance
-	result = append(result, strconv.Itoa(1e9)) // checking balance
+func (w *putWorkload) Record() error {
+	af, err := os.Create(accountFilePath)
+	if err != nil {
+		return errors.Wrapf(err, "fail to create account file %s", accountFilePath)
+	}
+	defer af.Close()
 
-	return result
+	for _, id := range w.accounts {
+		// only record the account id
+		if _, err = af.WriteString(id + "\n"); err != nil {
+			return errors.Wrapf(err, "fail to write account file %s", accountFilePath)
+		}
+	}
+	return nil
 }
 
-func getName(n int) string {
-	b := make([]rune, n)
-	for i := range b {
-		b[i] = chs[rand.Intn(len(chs))]
-	}
-	return string(b)
+// conflictWorkload sends payments between the accounts in the account file,
+// where hot accounts are chosen with the probability of the conflict ratio
+type conflictWorkload struct {
+	accounts        []string
+	hotAccountRatio float64
+	conflictRatio   float64
 }
 
-func (wg *WorkloadGenerator) generateCCArgsConflict() []string {
-	var result []string
+// Init loads the accounts, which must split into non-empty hot and cold ones as required by the ratios
+func (w *conflictWorkload) Init(c *Config) error {
+	w.hotAccountRatio = c.HotAccountRatio
+	w.conflictRatio = c.ConflictRatio
 
-	senderName, receiverName := wg.selectTwoDifferentAccounts()
+	accounts, err := loadAccountsFromFile()
+	if err != nil {
+		return err
+	}
+	w.accounts = accounts
 
-	result = append(result, "SendPayment") // function name
-	result = append(result, senderName)    // sender name
-	result = append(result, receiverName)  // receiver name
-	result = append(result, "1")           // amount
+	var errs ConfigErrors
+	hotAccountNum := int(c.HotAccountRatio * float64(len(accounts)))
+	if c.ConflictRatio > 0 && hotAccountNum == 0 {
+		errs.addf("hot account ratio %f of %d accounts yields no hot account", c.HotAccountRatio, len(accounts))
+	}
+	if c.ConflictRatio < 1 && len(accounts)-hotAccountNum == 0 {
+		errs.addf("hot account ratio %f of %d accounts yields no cold account", c.HotAccountRatio, len(accounts))
+	}
+	return errs.err()
+}
 
-	return result
+func (w *conflictWorkload) Next() (*Invocation, error) {
+	senderName, receiverName := w.selectTwoDifferentAccounts()
+
+	return &Invocation{
+		Function: "SendPayment",
+		Args: []string{
+			senderName,   // sender name
+			receiverName, // receiver name
+			"1",          // amount
+		},
+	}, nil
 }
 
-func (wg *WorkloadGenerator) selectTwoDifferentAccounts() (string, string) {
-	senderName := wg.selectAccount()
-	receiverName := wg.selectAccount()
+func (w *conflictWorkload) selectTwoDifferentAccounts() (string, string) {
+	senderName := w.selectAccount()
+	receiverName := w.selectAccount()
 	for senderName == receiverName {
-		receiverName = wg.selectAccount()
+		receiverName = w.selectAccount()
 	}
 
 	return senderName, receiverName
 }
 
-func (wg *WorkloadGenerator) selectAccount() string {
+func (w *conflictWorkload) selectAccount() string {
 	randomNumber := rand.Float64()
-	if randomNumber < config.ConflictRatio {
-		return wg.selectHotAccount()
+	if randomNumber < w.conflictRatio {
+		return w.selectHotAccount()
 	} else {
-		return wg.selectColdAccount()
+		return w.selectColdAccount()
 	}
 }
 
-func (wg *WorkloadGenerator) selectHotAccount() string {
-	hotAccountNumber := int(config.HotAccountRatio * float64(len(wg.accounts)))
+func (w *conflictWorkload) selectHotAccount() string {
+	hotAccountNumber := int(w.hotAccountRatio * float64(len(w.accounts)))
 	accountID := rand.Intn(hotAccountNumber)
-	accountName := wg.accounts[accountID]
+	accountName := w.accounts[accountID]
 	return accountName
 }
 
-func (wg *WorkloadGenerator) selectColdAccount() string {
-	hotAccountNumber := int(config.HotAccountRatio * float64(len(wg.accounts)))
-	coldAccountNumber := len(wg.accounts) - hotAccountNumber
+func (w *conflictWorkload) selectColdAccount() string {
+	hotAccountNumber := int(w.hotAccountRatio * float64(len(w.accounts)))
+	coldAccountNumber := len(w.accounts) - hotAccountNumber
 	accountID := rand.Intn(coldAccountNumber) + hotAccountNumber
-	accountName := wg.accounts[accountID]
+	accountName := w.accounts[accountID]
 	return accountName
 }
 
-func (wg *WorkloadGenerator) mustWriteArgsToFile() {
-	os.Remove(transactionFilePath)
-
-	tf, err := os.Create(transactionFilePath)
+// loadAccountsFromFile returns the ids of all accounts in the account file
+func loadAccountsFromFile() ([]string, error) {
+	af, err := os.Open(accountFilePath)
 	if err != nil {
-		logger.Fatalf("Failed to create file %s: %v\n", transactionFilePath, err)
-	}
-	defer tf.Close()
-
-	for i := 0; i < config.TxNum; i++ {
-		tf.WriteString(strconv.Itoa(i) + " " + strings.Join(wg.ccArgsList[i], " ") + "\n")
+		return nil, errors.Wrapf(err, "fail to open account file %s", accountFilePath)
 	}
-}
-
-func (wg *WorkloadGenerator) mustWriteAccountsToFile() {
-	af, err := os.Create(accountFilePath)
 	defer af.Close()
-	if err != nil {
-		logger.Fatalf("Failed to create file %s: %v\n", accountFilePath, err)
-	}
-	for i := 0; i < config.TxNum; i++ {
-		// only record the account id
-		af.WriteString(wg.ccArgsList[i][1] + "\n")
+
+	var accounts []string
+	input := bufio.NewScanner(af)
+	for input.Scan() {
+		accounts = append(accounts, input.Text())
 	}
+	return accounts, input.Err()
 }
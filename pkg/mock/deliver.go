@@ -0,0 +1,104 @@
+package mock
+
+import (
+	"context"
+	"io"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/osdi23p228/fabric-protos-go/common"
+	"github.com/osdi23p228/fabric-protos-go/orderer"
+	"github.com/osdi23p228/fabric/protoutil"
+	"github.com/pkg/errors"
+)
+
+// deliver serves the seek requests received from a deliver stream one after another,
+// sending the requested blocks and then a status as the real deliver service does
+func deliver(ctx context.Context, ledger *Ledger, recv func() (*common.Envelope, error),
+	sendBlock func(*common.Block) error, sendStatus func(common.Status) error) error {
+	for {
+		envelope, err := recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		status, err := deliverBlocks(ctx, ledger, envelope, sendBlock)
+		if err != nil {
+			return err
+		}
+		if err = sendStatus(status); err != nil {
+			return err
+		}
+	}
+}
+
+// deliverBlocks sends the blocks requested by the seek envelope, waiting for the ones not cut yet
+// unless the request asks to fail. It returns the status ending the request
+func deliverBlocks(ctx context.Context, ledger *Ledger, envelope *common.Envelope, sendBlock func(*common.Block) error) (common.Status, error) {
+	seekInfo, err := getSeekInfo(envelope)
+	if err != nil {
+		return common.Status_BAD_REQUEST, nil
+	}
+
+	height := ledger.Height()
+	start, err := getSeekNumber(seekInfo.Start, height)
+	if err != nil {
+		return common.Status_BAD_REQUEST, nil
+	}
+	stop, err := getSeekNumber(seekInfo.Stop, height)
+	if err != nil || start > stop {
+		return common.Status_BAD_REQUEST, nil
+	}
+
+	for number := start; ; number++ {
+		block, wait := ledger.Block(number)
+		for block == nil {
+			if seekInfo.Behavior == orderer.SeekInfo_FAIL_IF_NOT_READY {
+				return common.Status_NOT_FOUND, nil
+			}
+
+			select {
+			case <-wait:
+			case <-ctx.Done():
+				return common.Status_SERVICE_UNAVAILABLE, ctx.Err()
+			}
+			block, wait = ledger.Block(number)
+		}
+
+		if err = sendBlock(block); err != nil {
+			return common.Status_SERVICE_UNAVAILABLE, err
+		}
+		if number == stop {
+			return common.Status_SUCCESS, nil
+		}
+	}
+}
+
+func getSeekInfo(envelope *common.Envelope) (*orderer.SeekInfo, error) {
+	payload, err := protoutil.UnmarshalPayload(envelope.Payload)
+	if err != nil {
+		return nil, err
+	}
+
+	seekInfo := &orderer.SeekInfo{}
+	if err = proto.Unmarshal(payload.Data, seekInfo); err != nil {
+		return nil, err
+	}
+	return seekInfo, nil
+}
+
+// getSeekNumber returns the block number of the position in a ledger of the height
+func getSeekNumber(position *orderer.SeekPosition, height uint64) (uint64, error) {
+	switch t := position.GetType().(type) {
+	case *orderer.SeekPosition_Oldest:
+		return 0, nil
+	case *orderer.SeekPosition_Newest:
+		return height - 1, nil
+	case *orderer.SeekPosition_Specified:
+		return t.Specified.Number, nil
+	default:
+		return 0, errors.Errorf("unsupported seek position %v", position)
+	}
+}
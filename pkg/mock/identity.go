@@ -0,0 +1,143 @@
+package mock
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/osdi23p228/fabric-protos-go/common"
+	"github.com/osdi23p228/fabric-protos-go/msp"
+	"github.com/osdi23p228/fabric/protoutil"
+	"github.com/pkg/errors"
+)
+
+// NewCertificate creates a self-signed ECDSA certificate valid for the hosts,
+// and returns it along with its private key, both PEM-encoded
+func NewCertificate(commonName string, hosts []string) ([]byte, []byte, error) {
+	key, certPEM, err := newCertificate(commonName, hosts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
+
+func newCertificate(commonName string, hosts []string) (*ecdsa.PrivateKey, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(10 * 365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), nil
+}
+
+// signer signs endorsements on behalf of a peer
+type signer struct {
+	mspID string
+	cert  []byte
+	key   *ecdsa.PrivateKey
+}
+
+func newSigner(mspID string) (*signer, error) {
+	key, cert, err := newCertificate("peer0."+mspID, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &signer{
+		mspID: mspID,
+		cert:  cert,
+		key:   key,
+	}, nil
+}
+
+func (s *signer) Sign(msg []byte) ([]byte, error) {
+	digest := sha256.Sum256(msg)
+	return ecdsa.SignASN1(rand.Reader, s.key, digest[:])
+}
+
+func (s *signer) Serialize() ([]byte, error) {
+	return proto.Marshal(&msp.SerializedIdentity{
+		Mspid:   s.mspID,
+		IdBytes: s.cert,
+	})
+}
+
+// verifySignature checks the signature of the envelope against its creator's certificate.
+// Creators other than X.509 ones, e.g. Idemix ones, are trusted
+func verifySignature(envelope *common.Envelope) error {
+	payload, err := protoutil.UnmarshalPayload(envelope.Payload)
+	if err != nil {
+		return err
+	}
+	if payload.Header == nil {
+		return errors.New("missing payload header")
+	}
+	signatureHeader, err := protoutil.UnmarshalSignatureHeader(payload.Header.SignatureHeader)
+	if err != nil {
+		return err
+	}
+	identity, err := protoutil.UnmarshalSerializedIdentity(signatureHeader.Creator)
+	if err != nil {
+		return err
+	}
+
+	block, _ := pem.Decode(identity.IdBytes)
+	if block == nil {
+		return nil
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return err
+	}
+	key, ok := cert.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return nil
+	}
+
+	digest := sha256.Sum256(envelope.Payload)
+	if !ecdsa.VerifyASN1(key, digest[:], envelope.Signature) {
+		return errors.Errorf("signature of %s is invalid", identity.Mspid)
+	}
+	return nil
+}
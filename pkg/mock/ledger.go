@@ -0,0 +1,132 @@
+package mock
+
+import (
+	"sync"
+
+	"github.com/osdi23p228/fabric-protos-go/common"
+	"github.com/osdi23p228/fabric-protos-go/peer"
+	"github.com/osdi23p228/fabric/protoutil"
+)
+
+// Ledger is the chain of blocks written by the orderer and delivered by both the orderer and the peers
+type Ledger struct {
+	lock   sync.Mutex
+	blocks []*common.Block
+	txids  map[string]bool
+	notify chan struct{} // closed whenever a block is appended
+}
+
+// NewLedger creates a ledger with an empty genesis block
+func NewLedger() *Ledger {
+	return &Ledger{
+		blocks: []*common.Block{newBlock(0, nil, nil, nil)},
+		txids:  make(map[string]bool),
+		notify: make(chan struct{}),
+	}
+}
+
+// Height returns the number of blocks
+func (l *Ledger) Height() uint64 {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return uint64(len(l.blocks))
+}
+
+// Block returns the block with the number, or nil along with a channel
+// which is closed once a new block is appended if it does not exist yet
+func (l *Ledger) Block(number uint64) (*common.Block, <-chan struct{}) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if number < uint64(len(l.blocks)) {
+		return l.blocks[number], nil
+	}
+	return nil, l.notify
+}
+
+// Append cuts the envelopes into a new block. A transaction is marked BAD_PAYLOAD if it is malformed,
+// DUPLICATE_TXID if its txid has been committed before, or MVCC_READ_CONFLICT with the probability of the invalid rate
+func (l *Ledger) Append(envelopes [][]byte, invalidRate float64) *common.Block {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	txFilter := make([]byte, len(envelopes))
+	for i, data := range envelopes {
+		txid := getTxid(data)
+		code := peer.TxValidationCode_VALID
+		switch {
+		case txid == "":
+			code = peer.TxValidationCode_BAD_PAYLOAD
+		case l.txids[txid]:
+			code = peer.TxValidationCode_DUPLICATE_TXID
+		case happens(invalidRate):
+			code = peer.TxValidationCode_MVCC_READ_CONFLICT
+		}
+		if txid != "" {
+			l.txids[txid] = true
+		}
+		txFilter[i] = byte(code)
+	}
+
+	last := l.blocks[len(l.blocks)-1]
+	block := newBlock(uint64(len(l.blocks)), protoutil.BlockHeaderHash(last.Header), envelopes, txFilter)
+	l.blocks = append(l.blocks, block)
+
+	close(l.notify)
+	l.notify = make(chan struct{})
+
+	return block
+}
+
+func newBlock(number uint64, previousHash []byte, envelopes [][]byte, txFilter []byte) *common.Block {
+	block := protoutil.NewBlock(number, previousHash)
+	block.Data.Data = envelopes
+	block.Header.DataHash = protoutil.BlockDataHash(block.Data)
+	block.Metadata.Metadata[common.BlockMetadataIndex_SIGNATURES] = protoutil.MarshalOrPanic(&common.Metadata{})
+	block.Metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER] = txFilter
+	return block
+}
+
+// getTxid returns the txid of the envelope, or an empty string if it is malformed
+func getTxid(data []byte) string {
+	envelope, err := protoutil.UnmarshalEnvelope(data)
+	if err != nil {
+		return ""
+	}
+	channelHeader, err := protoutil.ChannelHeader(envelope)
+	if err != nil {
+		return ""
+	}
+	return channelHeader.TxId
+}
+
+// filterBlock converts a block into a filtered block, which only contains the txids and validation codes
+func filterBlock(block *common.Block) *peer.FilteredBlock {
+	fb := &peer.FilteredBlock{
+		Number: block.Header.Number,
+	}
+
+	txFilter := block.Metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER]
+	for i, data := range block.Data.Data {
+		envelope, err := protoutil.UnmarshalEnvelope(data)
+		if err != nil {
+			continue
+		}
+		channelHeader, err := protoutil.ChannelHeader(envelope)
+		if err != nil {
+			continue
+		}
+
+		if fb.ChannelId == "" {
+			fb.ChannelId = channelHeader.ChannelId
+		}
+		fb.FilteredTransactions = append(fb.FilteredTransactions, &peer.FilteredTransaction{
+			Txid:             channelHeader.TxId,
+			Type:             common.HeaderType(channelHeader.Type),
+			TxValidationCode: peer.TxValidationCode(txFilter[i]),
+		})
+	}
+
+	return fb
+}
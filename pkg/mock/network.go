@@ -0,0 +1,151 @@
+// Package mock provides an in-process Fabric network, i.e. peers and an orderer which endorse,
+// order and deliver transactions without running chaincodes or validating anything but signatures,
+// so that tape can be exercised end to end without a real network
+package mock
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"time"
+
+	"github.com/osdi23p228/tape/pkg/comm"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultBlockSize    = 10
+	defaultBlockTimeout = 100 * time.Millisecond
+)
+
+// Options controls the behaviors of the mock network
+type Options struct {
+	Latency            time.Duration // delay of every endorsement and broadcast
+	EndorseErrorRate   float64       // fraction of proposals answered with status 500
+	BroadcastErrorRate float64       // fraction of envelopes rejected with status SERVICE_UNAVAILABLE
+	InvalidRate        float64       // fraction of transactions marked MVCC_READ_CONFLICT in blocks
+	BlockSize          int           // maximum number of transactions in a block, 10 by default
+	BlockTimeout       time.Duration // time to wait for more transactions before cutting a block, 100ms by default
+	TLS                bool          // serve TLS with a self-signed certificate, which is also the TLS root certificate
+}
+
+func (o Options) validate() error {
+	rates := []struct {
+		name string
+		rate float64
+	}{
+		{"endorse error rate", o.EndorseErrorRate},
+		{"broadcast error rate", o.BroadcastErrorRate},
+		{"invalid rate", o.InvalidRate},
+	}
+	for _, r := range rates {
+		if r.rate < 0 || r.rate > 1 {
+			return errors.Errorf("%s %v is not within [0, 1]", r.name, r.rate)
+		}
+	}
+	if o.Latency < 0 || o.BlockSize < 0 || o.BlockTimeout < 0 {
+		return errors.New("latency, block size and block timeout must not be negative")
+	}
+	return nil
+}
+
+// delay sleeps for the latency
+func (o Options) delay() {
+	if o.Latency > 0 {
+		time.Sleep(o.Latency)
+	}
+}
+
+// happens returns true with the probability of the rate
+func happens(rate float64) bool {
+	return rate > 0 && rand.Float64() < rate
+}
+
+// Network is a set of peers and an orderer sharing the same ledger,
+// where the peers belong to organizations Org1MSP, Org2MSP, and so on
+type Network struct {
+	Peers     []*Peer
+	Orderer   *Orderer
+	TLSCACert []byte // PEM-encoded TLS root certificate, only available if TLS is enabled
+
+	ledger *Ledger
+}
+
+// StartNetwork starts a peer listening on each of the peer addresses and an orderer,
+// where a port 0 picks a free one
+func StartNetwork(peerAddresses []string, ordererAddress string, opts Options) (*Network, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	if opts.BlockSize == 0 {
+		opts.BlockSize = defaultBlockSize
+	}
+	if opts.BlockTimeout == 0 {
+		opts.BlockTimeout = defaultBlockTimeout
+	}
+
+	n := &Network{
+		ledger: NewLedger(),
+	}
+
+	var tlsCert, tlsKey []byte
+	if opts.TLS {
+		hosts := []string{"localhost", "127.0.0.1"}
+		for _, address := range append(peerAddresses, ordererAddress) {
+			if host, _, err := net.SplitHostPort(address); err == nil && host != "" {
+				hosts = append(hosts, host)
+			}
+		}
+
+		var err error
+		if tlsCert, tlsKey, err = NewCertificate("tlsca", hosts); err != nil {
+			return nil, errors.Wrap(err, "fail to create TLS certificate")
+		}
+		n.TLSCACert = tlsCert
+	}
+
+	for i, address := range peerAddresses {
+		p, err := newPeer(address, fmt.Sprintf("Org%dMSP", i+1), tlsCert, tlsKey, n.ledger, opts)
+		if err != nil {
+			n.Stop()
+			return nil, errors.Wrapf(err, "fail to start peer %s", address)
+		}
+		n.Peers = append(n.Peers, p)
+	}
+
+	o, err := newOrderer(ordererAddress, tlsCert, tlsKey, n.ledger, opts)
+	if err != nil {
+		n.Stop()
+		return nil, errors.Wrapf(err, "fail to start orderer %s", ordererAddress)
+	}
+	n.Orderer = o
+
+	return n, nil
+}
+
+// Stop stops all nodes of the network
+func (n *Network) Stop() {
+	for _, p := range n.Peers {
+		p.stop()
+	}
+	if n.Orderer != nil {
+		n.Orderer.stop()
+	}
+}
+
+// Height returns the number of blocks in the ledger, including the genesis block
+func (n *Network) Height() uint64 {
+	return n.ledger.Height()
+}
+
+// newGRPCServer creates a server listening on the address, serving TLS if the certificate is provided
+func newGRPCServer(address string, tlsCert, tlsKey []byte) (*comm.GRPCServer, error) {
+	return comm.NewGRPCServer(address, comm.ServerConfig{
+		SecOpts: comm.SecureOptions{
+			UseTLS:      tlsCert != nil,
+			Certificate: tlsCert,
+			Key:         tlsKey,
+		},
+		KaOpts: comm.DefaultKeepaliveOptions,
+	})
+}
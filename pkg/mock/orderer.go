@@ -0,0 +1,144 @@
+package mock
+
+import (
+	"io"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/osdi23p228/fabric-protos-go/common"
+	"github.com/osdi23p228/fabric-protos-go/orderer"
+	"github.com/osdi23p228/tape/pkg/comm"
+)
+
+// Orderer serves the AtomicBroadcast service. It accepts every envelope signed by its creator and cuts them into blocks
+// of the block size, or fewer if no more envelope arrives within the block timeout
+type Orderer struct {
+	server     *comm.GRPCServer
+	ledger     *Ledger
+	opts       Options
+	envelopeCh chan []byte
+	doneCh     chan struct{}
+}
+
+func newOrderer(address string, tlsCert, tlsKey []byte, ledger *Ledger, opts Options) (*Orderer, error) {
+	server, err := newGRPCServer(address, tlsCert, tlsKey)
+	if err != nil {
+		return nil, err
+	}
+
+	o := &Orderer{
+		server:     server,
+		ledger:     ledger,
+		opts:       opts,
+		envelopeCh: make(chan []byte, opts.BlockSize),
+		doneCh:     make(chan struct{}),
+	}
+	orderer.RegisterAtomicBroadcastServer(server.Server(), o)
+	go o.cutBlocks()
+	go server.Start()
+
+	return o, nil
+}
+
+// Address returns the address the orderer listens on
+func (o *Orderer) Address() string {
+	return o.server.Address()
+}
+
+func (o *Orderer) stop() {
+	close(o.doneCh)
+	o.server.Stop()
+}
+
+// Broadcast acknowledges each envelope after the latency. It rejects the envelope with the probability
+// of the broadcast error rate, or if its signature is invalid as the real orderer does
+func (o *Orderer) Broadcast(stream orderer.AtomicBroadcast_BroadcastServer) error {
+	for {
+		envelope, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		o.opts.delay()
+
+		if happens(o.opts.BroadcastErrorRate) {
+			err = stream.Send(&orderer.BroadcastResponse{
+				Status: common.Status_SERVICE_UNAVAILABLE,
+				Info:   "injected broadcast failure",
+			})
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err = verifySignature(envelope); err != nil {
+			err = stream.Send(&orderer.BroadcastResponse{
+				Status: common.Status_FORBIDDEN,
+				Info:   err.Error(),
+			})
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		data, err := proto.Marshal(envelope)
+		if err != nil {
+			return err
+		}
+		select {
+		case o.envelopeCh <- data:
+		case <-o.doneCh:
+			return nil
+		}
+
+		if err = stream.Send(&orderer.BroadcastResponse{Status: common.Status_SUCCESS}); err != nil {
+			return err
+		}
+	}
+}
+
+// Deliver delivers full blocks
+func (o *Orderer) Deliver(stream orderer.AtomicBroadcast_DeliverServer) error {
+	return deliver(stream.Context(), o.ledger, stream.Recv,
+		func(block *common.Block) error {
+			return stream.Send(&orderer.DeliverResponse{Type: &orderer.DeliverResponse_Block{Block: block}})
+		},
+		func(status common.Status) error {
+			return stream.Send(&orderer.DeliverResponse{Type: &orderer.DeliverResponse_Status{Status: status}})
+		})
+}
+
+// cutBlocks appends a block to the ledger whenever the pending envelopes fill a block,
+// or the block timeout expires after the first of them arrives
+func (o *Orderer) cutBlocks() {
+	var pending [][]byte
+	var timeout <-chan time.Time
+
+	cut := func() {
+		o.ledger.Append(pending, o.opts.InvalidRate)
+		pending = nil
+		timeout = nil
+	}
+
+	for {
+		select {
+		case data := <-o.envelopeCh:
+			pending = append(pending, data)
+			if len(pending) == 1 {
+				timeout = time.After(o.opts.BlockTimeout)
+			}
+			if len(pending) >= o.opts.BlockSize {
+				cut()
+			}
+		case <-timeout:
+			cut()
+		case <-o.doneCh:
+			return
+		}
+	}
+}
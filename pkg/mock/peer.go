@@ -0,0 +1,165 @@
+package mock
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/osdi23p228/fabric-protos-go/common"
+	"github.com/osdi23p228/fabric-protos-go/ledger/rwset"
+	"github.com/osdi23p228/fabric-protos-go/ledger/rwset/kvrwset"
+	"github.com/osdi23p228/fabric-protos-go/peer"
+	"github.com/osdi23p228/fabric/protoutil"
+	"github.com/osdi23p228/tape/pkg/comm"
+)
+
+// Peer serves the Endorser and Deliver services. It endorses every proposal by writing
+// its arguments to the state without running the chaincode, so all peers return the same payload
+type Peer struct {
+	MSPID string
+
+	server *comm.GRPCServer
+	signer *signer
+	ledger *Ledger
+	opts   Options
+}
+
+func newPeer(address, mspID string, tlsCert, tlsKey []byte, ledger *Ledger, opts Options) (*Peer, error) {
+	signer, err := newSigner(mspID)
+	if err != nil {
+		return nil, err
+	}
+
+	server, err := newGRPCServer(address, tlsCert, tlsKey)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Peer{
+		MSPID:  mspID,
+		server: server,
+		signer: signer,
+		ledger: ledger,
+		opts:   opts,
+	}
+	peer.RegisterEndorserServer(server.Server(), p)
+	peer.RegisterDeliverServer(server.Server(), p)
+	go server.Start()
+
+	return p, nil
+}
+
+// Address returns the address the peer listens on
+func (p *Peer) Address() string {
+	return p.server.Address()
+}
+
+func (p *Peer) stop() {
+	p.server.Stop()
+}
+
+// ProcessProposal endorses the proposal after the latency, or fails it with the probability of the endorse error rate
+func (p *Peer) ProcessProposal(ctx context.Context, signedProposal *peer.SignedProposal) (*peer.ProposalResponse, error) {
+	p.opts.delay()
+
+	if happens(p.opts.EndorseErrorRate) {
+		return &peer.ProposalResponse{
+			Response: &peer.Response{Status: 500, Message: "injected endorsement failure"},
+		}, nil
+	}
+
+	proposal, err := protoutil.UnmarshalProposal(signedProposal.ProposalBytes)
+	if err != nil {
+		return badProposalResponse(err), nil
+	}
+	header, err := protoutil.UnmarshalHeader(proposal.Header)
+	if err != nil {
+		return badProposalResponse(err), nil
+	}
+	channelHeader, err := protoutil.UnmarshalChannelHeader(header.ChannelHeader)
+	if err != nil {
+		return badProposalResponse(err), nil
+	}
+	extension, err := protoutil.UnmarshalChaincodeHeaderExtension(channelHeader.Extension)
+	if err != nil {
+		return badProposalResponse(err), nil
+	}
+	input, err := protoutil.UnmarshalChaincodeProposalPayload(proposal.Payload)
+	if err != nil {
+		return badProposalResponse(err), nil
+	}
+	spec := &peer.ChaincodeInvocationSpec{}
+	if err = proto.Unmarshal(input.Input, spec); err != nil {
+		return badProposalResponse(err), nil
+	}
+
+	ccid := extension.GetChaincodeId()
+	results, err := writeArgs(ccid.GetName(), spec.GetChaincodeSpec().GetInput().GetArgs())
+	if err != nil {
+		return nil, err
+	}
+
+	response := &peer.Response{Status: 200, Message: "OK"}
+	return protoutil.CreateProposalResponse(proposal.Header, proposal.Payload, response, results, nil, ccid, p.signer)
+}
+
+func badProposalResponse(err error) *peer.ProposalResponse {
+	return &peer.ProposalResponse{
+		Response: &peer.Response{Status: 400, Message: err.Error()},
+	}
+}
+
+// writeArgs creates a read-write set writing the arguments to the key of the first argument after the function name
+func writeArgs(namespace string, args [][]byte) ([]byte, error) {
+	var key string
+	if len(args) > 1 {
+		key = string(args[1])
+	}
+
+	kvRWSet, err := proto.Marshal(&kvrwset.KVRWSet{
+		Writes: []*kvrwset.KVWrite{{Key: key, Value: bytes.Join(args, []byte(" "))}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return proto.Marshal(&rwset.TxReadWriteSet{
+		DataModel: rwset.TxReadWriteSet_KV,
+		NsRwset:   []*rwset.NsReadWriteSet{{Namespace: namespace, Rwset: kvRWSet}},
+	})
+}
+
+// Deliver delivers full blocks
+func (p *Peer) Deliver(stream peer.Deliver_DeliverServer) error {
+	return deliver(stream.Context(), p.ledger, stream.Recv,
+		func(block *common.Block) error {
+			return stream.Send(&peer.DeliverResponse{Type: &peer.DeliverResponse_Block{Block: block}})
+		},
+		func(status common.Status) error {
+			return stream.Send(&peer.DeliverResponse{Type: &peer.DeliverResponse_Status{Status: status}})
+		})
+}
+
+// DeliverFiltered delivers filtered blocks
+func (p *Peer) DeliverFiltered(stream peer.Deliver_DeliverFilteredServer) error {
+	return deliver(stream.Context(), p.ledger, stream.Recv,
+		func(block *common.Block) error {
+			return stream.Send(&peer.DeliverResponse{Type: &peer.DeliverResponse_FilteredBlock{FilteredBlock: filterBlock(block)}})
+		},
+		func(status common.Status) error {
+			return stream.Send(&peer.DeliverResponse{Type: &peer.DeliverResponse_Status{Status: status}})
+		})
+}
+
+// DeliverWithPrivateData delivers full blocks without any private data
+func (p *Peer) DeliverWithPrivateData(stream peer.Deliver_DeliverWithPrivateDataServer) error {
+	return deliver(stream.Context(), p.ledger, stream.Recv,
+		func(block *common.Block) error {
+			return stream.Send(&peer.DeliverResponse{Type: &peer.DeliverResponse_BlockAndPrivateData{
+				BlockAndPrivateData: &peer.BlockAndPrivateData{Block: block},
+			}})
+		},
+		func(status common.Status) error {
+			return stream.Send(&peer.DeliverResponse{Type: &peer.DeliverResponse_Status{Status: status}})
+		})
+}